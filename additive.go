@@ -0,0 +1,72 @@
+package aujo
+
+import (
+	"fmt"
+	"math"
+)
+
+type Attenuation struct {
+	PitchOffset float64
+	P1          float64
+	P2          float64
+	P3          float64
+	P4          float64
+}
+
+// Additive is an instrument that sums sine harmonics of the pitch.
+type Additive struct {
+	Harmonics []float64
+
+	ADSR
+
+	Attenuation Attenuation
+}
+
+func (inst *Additive) Type() string {
+	return "additive"
+}
+
+func (inst *Additive) Validate() error {
+	for i, h := range inst.Harmonics {
+		if math.IsNaN(h) || math.IsInf(h, 0) {
+			return fmt.Errorf("harmonic %d is not a number", i)
+		}
+	}
+	if inst.Attenuation.P1 < 0 {
+		return fmt.Errorf("attenuation P1 %g is negative", inst.Attenuation.P1)
+	}
+	return inst.ADSR.Validate()
+}
+
+// factor returns the gain of the harmonics of pitch offset samples after
+// the latest event.
+func (a *Attenuation) factor(pitch float64, offset int64) float64 {
+	if a.P1 <= 0 {
+		return 1
+	}
+	p := pitch - a.PitchOffset
+	p *= a.P1 * p
+	atten := a.P2 / (p*(float64(offset)/(a.P3+1)+a.P4) + 1)
+	if atten > 1 {
+		atten = 1
+	}
+	return atten
+}
+
+func (inst *Additive) Mix(c *Channel, step float64, offset int64) float64 {
+	atten := inst.Attenuation.factor(c.Pitch, offset)
+	if atten < 1e-5 {
+		return 0
+	}
+
+	var sum float64
+	f := pitchToFreq(c.Pitch)
+	for i, v := range inst.Harmonics {
+		h := f * float64(i+1)
+		if h > SamplingFrequency/2 {
+			break
+		}
+		sum += v * math.Sin(step*h) * atten
+	}
+	return sum
+}
@@ -2,16 +2,36 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/rwelin/aujo"
+	"github.com/rwelin/aujo/preset"
+)
+
+var (
+	// ErrNotFound is returned by callbacks for items that do not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned by callbacks for changes that would break
+	// references to items.
+	ErrConflict = errors.New("conflict")
 )
 
 func Err(w http.ResponseWriter, err error) {
-	w.WriteHeader(http.StatusBadRequest)
+	status := http.StatusBadRequest
+	if errors.Is(err, ErrNotFound) {
+		status = http.StatusNotFound
+	} else if errors.Is(err, ErrConflict) {
+		status = http.StatusConflict
+	}
+	w.WriteHeader(status)
 	w.Write([]byte(err.Error()))
 	fmt.Fprintln(os.Stderr, err)
 }
@@ -19,45 +39,130 @@ func Err(w http.ResponseWriter, err error) {
 type Callbacks interface {
 	Mix() ([]byte, error)
 	UpdateInstrumentHarmonics(instrument int, harmonics []float64) error
+
+	Instruments() (aujo.Instruments, error)
+	Instrument(id int) (aujo.Instrument, error)
+	AddInstrument(inst aujo.Instrument) (int, error)
+	UpdateInstrument(id int, inst aujo.Instrument) error
+	PatchInstrument(id int, patch []byte) (aujo.Instrument, error)
+	DeleteInstrument(id int) error
+
+	Voices() ([]aujo.Voice, error)
+	Voice(id int) (aujo.Voice, error)
+	AddVoice(v aujo.Voice) (int, error)
+	UpdateVoice(id int, v aujo.Voice) error
+	PatchVoice(id int, patch []byte) (aujo.Voice, error)
+	DeleteVoice(id int) error
+
+	Master() (Master, error)
+	UpdateMaster(m Master) error
+
+	Transport() (aujo.TransportStatus, error)
+	Play() error
+	Pause() error
+	Stop() error
+	SetPosition(position int64) error
+	SetLoop(loop bool) error
+	SetSequence(name string, next bool) error
+	Sequences() ([]string, error)
+
+	// Subscribe returns messages about the mix and a function that ends
+	// the subscription.
+	Subscribe() (<-chan aujo.Message, func())
+
+	// Attach returns a sink that writes the audio to w as 16 bit little
+	// endian mono PCM without holding up the mix.
+	Attach(w io.Writer) *aujo.Sink
+
+	Presets() ([]string, error)
+	Preset(name string) (aujo.Instrument, error)
+	// SavePreset saves an instrument as a preset.
+	SavePreset(name string, instrument int) error
+	// LoadPreset replaces an instrument with a preset, and returns it.
+	LoadPreset(instrument int, name string) (aujo.Instrument, error)
+	DeletePreset(name string) error
+	DiffPresets(a string, b string) ([]preset.Change, error)
+
+	History() (History, error)
+	Undo() (History, error)
+	Redo() (History, error)
+
+	Recording() (Recording, error)
+	StartRecording() (Recording, error)
+	StopRecording() (Recording, error)
+	// SaveRewind saves the latest audio, and returns where it was saved.
+	SaveRewind() (Recording, error)
+}
+
+// Master holds the parameters of the whole mix.
+type Master struct {
+	Level float64
 }
 
 type handler struct {
 	Callbacks Callbacks
+	origins   []string // origins are the pages from other hosts that may use the API
 }
 
-func (h *handler) handleInstrumentPut(w http.ResponseWriter, r *http.Request) {
-	var voice []float64
-	err := json.NewDecoder(r.Body).Decode(&voice)
+func (h *handler) handleMixGet(w http.ResponseWriter, r *http.Request) {
+	d, err := h.Callbacks.Mix()
 	if err != nil {
 		Err(w, err)
 		return
 	}
 
-	id := mux.Vars(r)["id"]
-	i, err := strconv.Atoi(id)
-	if err != nil {
-		Err(w, err)
-	}
-
-	if err := h.Callbacks.UpdateInstrumentHarmonics(i, voice); err != nil {
-		Err(w, err)
-	}
+	w.Write(d)
 }
 
-func (h *handler) handleMixGet(w http.ResponseWriter, r *http.Request) {
-	d, err := h.Callbacks.Mix()
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	d, err := json.Marshal(v)
 	if err != nil {
-		Err(w, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		fmt.Fprintln(os.Stderr, err)
 		return
 	}
-
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	w.Write(d)
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
+func idVar(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["id"])
+}
+
+// allowedOrigin returns whether a request may use the API: requests from
+// clients that are not browsers, which send no Origin, from pages served
+// by the host of the API, and from the origins of the handler.
+func (h *handler) allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range h.origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsMiddleware lets the allowed origins use the API, and forbids the
+// others.
+func (h *handler) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		w.Header().Add("Vary", "Origin")
+		if !h.allowedOrigin(r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
 		if r.Method == http.MethodOptions {
 			return
@@ -66,17 +171,55 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func NewHandler(cb Callbacks) http.Handler {
+// NewHandler returns the handler of the API. Browsers may use it from
+// pages served by the same host, and from the origins, like
+// "http://localhost:8080", or from any page with "*".
+func NewHandler(cb Callbacks, origins ...string) http.Handler {
 	h := &handler{
 		Callbacks: cb,
+		origins:   origins,
 	}
 
 	sr := mux.NewRouter()
-	sr.HandleFunc("/instruments/{id}", h.handleInstrumentPut).Methods(http.MethodPut)
+	sr.HandleFunc("/instruments", h.handleInstrumentsGet).Methods(http.MethodGet)
+	sr.HandleFunc("/instruments", h.handleInstrumentsPost).Methods(http.MethodPost)
+	sr.HandleFunc("/instruments/schema", h.handleInstrumentSchemaGet).Methods(http.MethodGet)
+	sr.HandleFunc("/instruments/{id:[0-9]+}", h.handleInstrumentGet).Methods(http.MethodGet)
+	sr.HandleFunc("/instruments/{id:[0-9]+}", h.handleInstrumentPut).Methods(http.MethodPut)
+	sr.HandleFunc("/instruments/{id:[0-9]+}", h.handleInstrumentPatch).Methods(http.MethodPatch)
+	sr.HandleFunc("/instruments/{id:[0-9]+}", h.handleInstrumentDelete).Methods(http.MethodDelete)
+	sr.HandleFunc("/instruments/{id:[0-9]+}/preset", h.handleInstrumentPresetPost).Methods(http.MethodPost)
+	sr.HandleFunc("/presets", h.handlePresetsGet).Methods(http.MethodGet)
+	sr.HandleFunc("/presets/{name}", h.handlePresetGet).Methods(http.MethodGet)
+	sr.HandleFunc("/presets/{name}", h.handlePresetPut).Methods(http.MethodPut)
+	sr.HandleFunc("/presets/{name}", h.handlePresetDelete).Methods(http.MethodDelete)
+	sr.HandleFunc("/presets/{name}/diff/{other}", h.handlePresetDiffGet).Methods(http.MethodGet)
+	sr.HandleFunc("/voices", h.handleVoicesGet).Methods(http.MethodGet)
+	sr.HandleFunc("/voices", h.handleVoicesPost).Methods(http.MethodPost)
+	sr.HandleFunc("/voices/{id:[0-9]+}", h.handleVoiceGet).Methods(http.MethodGet)
+	sr.HandleFunc("/voices/{id:[0-9]+}", h.handleVoicePut).Methods(http.MethodPut)
+	sr.HandleFunc("/voices/{id:[0-9]+}", h.handleVoicePatch).Methods(http.MethodPatch)
+	sr.HandleFunc("/voices/{id:[0-9]+}", h.handleVoiceDelete).Methods(http.MethodDelete)
+	sr.HandleFunc("/master", h.handleMasterGet).Methods(http.MethodGet)
+	sr.HandleFunc("/master", h.handleMasterPut).Methods(http.MethodPut)
+	sr.HandleFunc("/transport", h.handleTransportGet).Methods(http.MethodGet)
+	sr.HandleFunc("/transport/{action:play|pause|stop}", h.handleTransportPost).Methods(http.MethodPost)
+	sr.HandleFunc("/transport/position", h.handlePositionPut).Methods(http.MethodPut)
+	sr.HandleFunc("/transport/loop", h.handleLoopPut).Methods(http.MethodPut)
+	sr.HandleFunc("/transport/sequence", h.handleSequencePut).Methods(http.MethodPut)
+	sr.HandleFunc("/sequences", h.handleSequencesGet).Methods(http.MethodGet)
+	sr.HandleFunc("/history", h.handleHistoryGet).Methods(http.MethodGet)
+	sr.HandleFunc("/history/{action:undo|redo}", h.handleHistoryPost).Methods(http.MethodPost)
+	sr.HandleFunc("/recording", h.handleRecordingGet).Methods(http.MethodGet)
+	sr.HandleFunc("/recording/{action:start|stop|rewind}", h.handleRecordingPost).Methods(http.MethodPost)
+	sr.HandleFunc("/ws", h.handleWebsocket).Methods(http.MethodGet)
+	sr.HandleFunc("/events", h.handleEvents).Methods(http.MethodGet)
+	sr.HandleFunc("/stream.wav", h.handleStream(true)).Methods(http.MethodGet)
+	sr.HandleFunc("/stream.pcm", h.handleStream(false)).Methods(http.MethodGet)
 	sr.HandleFunc("/mix", h.handleMixGet).Methods(http.MethodGet)
 
 	r := mux.NewRouter()
-	r.Use(corsMiddleware)
+	r.Use(h.corsMiddleware)
 	r.PathPrefix("/").Handler(sr)
 	return r
 }
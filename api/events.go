@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/rwelin/aujo"
+)
+
+// handleWebsocket streams the messages of the mix as JSON text messages
+// until the client goes away.
+func (h *handler) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	c, err := upgradeWebsocket(w, r, h.allowedOrigin)
+	if err != nil {
+		return
+	}
+	defer c.Close()
+
+	msgs, cancel := h.Callbacks.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			d, err := json.Marshal(msg)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			if err := c.WriteText(d); err != nil {
+				return
+			}
+		case <-c.Closed():
+			return
+		}
+	}
+}
+
+// handleEvents streams the messages of the mix about the music as JSON
+// lines until the client goes away: the types in the types parameter,
+// separated by commas, or else aujo.LogTypes.
+func (h *handler) handleEvents(w http.ResponseWriter, r *http.Request) {
+	types := aujo.LogTypes
+	if t := r.URL.Query().Get("types"); t != "" {
+		types = strings.Split(t, ",")
+	}
+	wanted := make(map[string]bool)
+	for _, t := range types {
+		wanted[t] = true
+	}
+
+	msgs, cancel := h.Callbacks.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(flushWriter{w})
+
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			if !wanted[msg.Type] {
+				continue
+			}
+			if err := enc.Encode(msg); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rwelin/aujo"
+)
+
+// History lists the changes to the mix. The steps up to Position have been
+// applied: undo reverts the step at Position, and redo applies the next.
+type History struct {
+	Steps    []aujo.HistoryStep
+	Position int
+}
+
+func (h *handler) handleHistoryGet(w http.ResponseWriter, r *http.Request) {
+	hist, err := h.Callbacks.History()
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hist)
+}
+
+func (h *handler) handleHistoryPost(w http.ResponseWriter, r *http.Request) {
+	var hist History
+	var err error
+	switch mux.Vars(r)["action"] {
+	case "undo":
+		hist, err = h.Callbacks.Undo()
+	case "redo":
+		hist, err = h.Callbacks.Redo()
+	}
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hist)
+}
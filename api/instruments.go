@@ -0,0 +1,159 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/rwelin/aujo"
+)
+
+func readInstrument(r *http.Request) (aujo.Instrument, error) {
+	d, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	inst, err := aujo.UnmarshalInstrument(d)
+	if err != nil {
+		return nil, err
+	}
+	if err := inst.Validate(); err != nil {
+		return nil, err
+	}
+	return inst, nil
+}
+
+func writeInstrument(w http.ResponseWriter, status int, inst aujo.Instrument) {
+	d, err := aujo.MarshalInstrument(inst)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeJSON(w, status, json.RawMessage(d))
+}
+
+func (h *handler) handleInstrumentsGet(w http.ResponseWriter, r *http.Request) {
+	is, err := h.Callbacks.Instruments()
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, is)
+}
+
+func (h *handler) handleInstrumentsPost(w http.ResponseWriter, r *http.Request) {
+	inst, err := readInstrument(r)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+
+	id, err := h.Callbacks.AddInstrument(inst)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/instruments/%d", id))
+	writeJSON(w, http.StatusCreated, struct{ Id int }{id})
+}
+
+func (h *handler) handleInstrumentGet(w http.ResponseWriter, r *http.Request) {
+	id, err := idVar(r)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+
+	inst, err := h.Callbacks.Instrument(id)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeInstrument(w, http.StatusOK, inst)
+}
+
+// handleInstrumentPut replaces an instrument, or only its harmonics when the
+// body is an array.
+func (h *handler) handleInstrumentPut(w http.ResponseWriter, r *http.Request) {
+	id, err := idVar(r)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+
+	d, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(d), []byte("[")) {
+		var harmonics []float64
+		if err := json.Unmarshal(d, &harmonics); err != nil {
+			Err(w, err)
+			return
+		}
+		if err := h.Callbacks.UpdateInstrumentHarmonics(id, harmonics); err != nil {
+			Err(w, err)
+		}
+		return
+	}
+
+	inst, err := aujo.UnmarshalInstrument(d)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	if err := inst.Validate(); err != nil {
+		Err(w, err)
+		return
+	}
+
+	if err := h.Callbacks.UpdateInstrument(id, inst); err != nil {
+		Err(w, err)
+		return
+	}
+	writeInstrument(w, http.StatusOK, inst)
+}
+
+func (h *handler) handleInstrumentPatch(w http.ResponseWriter, r *http.Request) {
+	id, err := idVar(r)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+
+	patch, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+
+	inst, err := h.Callbacks.PatchInstrument(id, patch)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeInstrument(w, http.StatusOK, inst)
+}
+
+func (h *handler) handleInstrumentDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := idVar(r)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+
+	if err := h.Callbacks.DeleteInstrument(id); err != nil {
+		Err(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) handleInstrumentSchemaGet(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, InstrumentSchema())
+}
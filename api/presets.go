@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rwelin/aujo/preset"
+)
+
+func (h *handler) handlePresetsGet(w http.ResponseWriter, r *http.Request) {
+	names, err := h.Callbacks.Presets()
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+func (h *handler) handlePresetGet(w http.ResponseWriter, r *http.Request) {
+	inst, err := h.Callbacks.Preset(mux.Vars(r)["name"])
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeInstrument(w, http.StatusOK, inst)
+}
+
+// handlePresetPut saves an instrument of the mix as a preset.
+func (h *handler) handlePresetPut(w http.ResponseWriter, r *http.Request) {
+	var p struct {
+		Instrument int
+	}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		Err(w, err)
+		return
+	}
+	name := mux.Vars(r)["name"]
+	if err := h.Callbacks.SavePreset(name, p.Instrument); err != nil {
+		Err(w, err)
+		return
+	}
+	h.handlePresetGet(w, r)
+}
+
+func (h *handler) handlePresetDelete(w http.ResponseWriter, r *http.Request) {
+	if err := h.Callbacks.DeletePreset(mux.Vars(r)["name"]); err != nil {
+		Err(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) handlePresetDiffGet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	changes, err := h.Callbacks.DiffPresets(vars["name"], vars["other"])
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	if changes == nil {
+		changes = []preset.Change{}
+	}
+	writeJSON(w, http.StatusOK, changes)
+}
+
+// handleInstrumentPresetPost replaces an instrument with a preset.
+func (h *handler) handleInstrumentPresetPost(w http.ResponseWriter, r *http.Request) {
+	id, err := idVar(r)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	var p struct {
+		Name string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		Err(w, err)
+		return
+	}
+	inst, err := h.Callbacks.LoadPreset(id, p.Name)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeInstrument(w, http.StatusOK, inst)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Recording describes a recording of the mix and its files.
+type Recording struct {
+	Active  bool
+	Audio   string  // Audio is the WAVE file
+	Events  string  // Events is the log of the notes and sequences played
+	Seconds float64 // Seconds is the length of the audio
+	Dropped int64   // Dropped is the number of blocks of audio missing because writing did not keep up
+}
+
+func (h *handler) handleRecordingGet(w http.ResponseWriter, r *http.Request) {
+	rec, err := h.Callbacks.Recording()
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
+
+func (h *handler) handleRecordingPost(w http.ResponseWriter, r *http.Request) {
+	var rec Recording
+	var err error
+	switch mux.Vars(r)["action"] {
+	case "start":
+		rec, err = h.Callbacks.StartRecording()
+	case "stop":
+		rec, err = h.Callbacks.StopRecording()
+	case "rewind":
+		rec, err = h.Callbacks.SaveRewind()
+	}
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
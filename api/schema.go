@@ -0,0 +1,77 @@
+package api
+
+import (
+	"reflect"
+
+	"github.com/rwelin/aujo"
+)
+
+// Schema is a JSON schema.
+type Schema map[string]interface{}
+
+// schemaOf describes the JSON encoding of a type. Embedded structs are
+// flattened like encoding/json does.
+func schemaOf(t reflect.Type) Schema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Struct:
+		props := Schema{}
+		addProperties(props, t)
+		return Schema{"type": "object", "properties": props}
+	}
+	return Schema{}
+}
+
+func addProperties(props Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			addProperties(props, f.Type)
+			continue
+		}
+		if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+			continue
+		}
+		props[f.Name] = schemaOf(f.Type)
+	}
+}
+
+// InstrumentSchema describes the instrument objects of the API, one
+// alternative per instrument type.
+func InstrumentSchema() Schema {
+	var types []interface{}
+	var alternatives []interface{}
+	for _, typ := range aujo.InstrumentTypes() {
+		inst, _ := aujo.NewInstrument(typ)
+		s := schemaOf(reflect.TypeOf(inst))
+		s["title"] = typ
+		s["properties"].(Schema)["Type"] = Schema{"const": typ}
+		if typ != aujo.DefaultInstrumentType {
+			s["required"] = []string{"Type"}
+		}
+		types = append(types, typ)
+		alternatives = append(alternatives, s)
+	}
+
+	return Schema{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title":   "Instrument",
+		"type":    "object",
+		"properties": Schema{
+			"Type": Schema{"type": "string", "enum": types},
+		},
+		"oneOf": alternatives,
+	}
+}
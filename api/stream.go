@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/rwelin/aujo"
+)
+
+// handleStream sends the live audio of the mix until the client goes away,
+// either as a WAVE file of unknown length or as raw 16 bit little endian
+// mono PCM at aujo.SamplingFrequency.
+func (h *handler) handleStream(wav bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if wav {
+			w.Header().Set("Content-Type", "audio/wav")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		if wav {
+			if _, err := w.Write(aujo.WavHeader()); err != nil {
+				return
+			}
+		}
+
+		s := h.Callbacks.Attach(flushWriter{w})
+		defer s.Detach()
+
+		select {
+		case <-s.Done():
+		case <-r.Context().Done():
+		}
+	}
+}
+
+// flushWriter sends each write to the client immediately.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if f, ok := fw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *handler) writeTransport(w http.ResponseWriter) {
+	s, err := h.Callbacks.Transport()
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+func (h *handler) handleTransportGet(w http.ResponseWriter, r *http.Request) {
+	h.writeTransport(w)
+}
+
+func (h *handler) handleTransportPost(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch mux.Vars(r)["action"] {
+	case "play":
+		err = h.Callbacks.Play()
+	case "pause":
+		err = h.Callbacks.Pause()
+	case "stop":
+		err = h.Callbacks.Stop()
+	}
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	h.writeTransport(w)
+}
+
+func (h *handler) handlePositionPut(w http.ResponseWriter, r *http.Request) {
+	var p struct {
+		Position int64
+	}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		Err(w, err)
+		return
+	}
+	if err := h.Callbacks.SetPosition(p.Position); err != nil {
+		Err(w, err)
+		return
+	}
+	h.writeTransport(w)
+}
+
+func (h *handler) handleLoopPut(w http.ResponseWriter, r *http.Request) {
+	var l struct {
+		Loop bool
+	}
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		Err(w, err)
+		return
+	}
+	if err := h.Callbacks.SetLoop(l.Loop); err != nil {
+		Err(w, err)
+		return
+	}
+	h.writeTransport(w)
+}
+
+// handleSequencePut switches to a sequence by name, immediately or, with
+// Next, when the current sequence ends.
+func (h *handler) handleSequencePut(w http.ResponseWriter, r *http.Request) {
+	var s struct {
+		Name string
+		Next bool
+	}
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		Err(w, err)
+		return
+	}
+	if err := h.Callbacks.SetSequence(s.Name, s.Next); err != nil {
+		Err(w, err)
+		return
+	}
+	h.writeTransport(w)
+}
+
+func (h *handler) handleSequencesGet(w http.ResponseWriter, r *http.Request) {
+	names, err := h.Callbacks.Sequences()
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, names)
+}
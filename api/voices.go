@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/rwelin/aujo"
+)
+
+func (h *handler) handleVoicesGet(w http.ResponseWriter, r *http.Request) {
+	vs, err := h.Callbacks.Voices()
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, vs)
+}
+
+func (h *handler) handleVoicesPost(w http.ResponseWriter, r *http.Request) {
+	var v aujo.Voice
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		Err(w, err)
+		return
+	}
+
+	id, err := h.Callbacks.AddVoice(v)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/voices/%d", id))
+	writeJSON(w, http.StatusCreated, struct{ Id int }{id})
+}
+
+func (h *handler) handleVoiceGet(w http.ResponseWriter, r *http.Request) {
+	id, err := idVar(r)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+
+	v, err := h.Callbacks.Voice(id)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (h *handler) handleVoicePut(w http.ResponseWriter, r *http.Request) {
+	id, err := idVar(r)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+
+	var v aujo.Voice
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		Err(w, err)
+		return
+	}
+
+	if err := h.Callbacks.UpdateVoice(id, v); err != nil {
+		Err(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (h *handler) handleVoicePatch(w http.ResponseWriter, r *http.Request) {
+	id, err := idVar(r)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+
+	patch, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+
+	v, err := h.Callbacks.PatchVoice(id, patch)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (h *handler) handleVoiceDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := idVar(r)
+	if err != nil {
+		Err(w, err)
+		return
+	}
+
+	if err := h.Callbacks.DeleteVoice(id); err != nil {
+		Err(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) handleMasterGet(w http.ResponseWriter, r *http.Request) {
+	m, err := h.Callbacks.Master()
+	if err != nil {
+		Err(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+func (h *handler) handleMasterPut(w http.ResponseWriter, r *http.Request) {
+	var m Master
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		Err(w, err)
+		return
+	}
+	if m.Level < 0 {
+		Err(w, fmt.Errorf("level %g is negative", m.Level))
+		return
+	}
+
+	if err := h.Callbacks.UpdateMaster(m); err != nil {
+		Err(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const websocketWriteTimeout = 10 * time.Second
+
+// websocketReadLimit is the largest message a client may send. Clients
+// only send control messages.
+const websocketReadLimit = 4096
+
+// wsConn is the server side of a WebSocket connection. It only sends text
+// messages, and discards the data messages of the client.
+type wsConn struct {
+	conn   *websocket.Conn
+	mutex  sync.Mutex // mutex serializes writes
+	closed chan struct{}
+	once   sync.Once
+}
+
+// upgradeWebsocket takes over an HTTP connection with the WebSocket
+// handshake, if the origin of the request is allowed. On failure the
+// response has been written.
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request, allowed func(*http.Request) bool) (*wsConn, error) {
+	upgrader := websocket.Upgrader{CheckOrigin: allowed}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadLimit(websocketReadLimit)
+	c := &wsConn{
+		conn:   conn,
+		closed: make(chan struct{}),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// WriteText sends a text message.
+func (c *wsConn) WriteText(data []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Closed is closed when the connection has been closed by either side.
+func (c *wsConn) Closed() <-chan struct{} {
+	return c.closed
+}
+
+// Close sends a close message and closes the connection.
+func (c *wsConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(websocketWriteTimeout))
+		err = c.conn.Close()
+		close(c.closed)
+	})
+	return err
+}
+
+// readLoop reads until the client closes the connection or breaks the
+// protocol. Pings and closes are answered by the connection.
+func (c *wsConn) readLoop() {
+	defer c.Close()
+	for {
+		if _, _, err := c.conn.NextReader(); err != nil {
+			return
+		}
+	}
+}
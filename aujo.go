@@ -1,14 +1,14 @@
 package aujo
 
 import (
-	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
-	"os"
+	"path/filepath"
 	"sync"
-
-	"github.com/rwelin/aujo/dsp"
+	"sync/atomic"
 )
 
 const SamplingFrequency = float64(44100.0)
@@ -19,97 +19,16 @@ type Envelope struct {
 	Time  int64
 }
 
-type Attenuation struct {
-	PitchOffset float64
-	P1          float64
-	P2          float64
-	P3          float64
-	P4          float64
-}
-
-type Instrument struct {
-	Harmonics []float64
-
-	Attack  Envelope
-	Decay   Envelope
-	Sustain Envelope
-	Release Envelope
-
-	Attenuation Attenuation
-}
-
-func interpolate(index int64, e1 Envelope, val float64) float64 {
-	lev := (e1.Value-val)/float64(e1.Time)*float64(index) + val
-	if lev < 1e-10 {
-		lev = 0
-	}
-	return lev
-}
-
-func (inst *Instrument) Level(event EventType, index int64, level float64) (float64, bool) {
-	if index < 0 {
-		return 0, false
-	}
-
-	switch event {
-	case EventOn:
-		if index < inst.Attack.Time {
-			return interpolate(index, inst.Attack, level), true
-		}
-		index -= inst.Attack.Time
-		if index < inst.Decay.Time {
-			return interpolate(index, inst.Decay, inst.Attack.Value), true
-		}
-		index -= inst.Decay.Time
-		if index < inst.Sustain.Time {
-			return interpolate(index, inst.Sustain, inst.Decay.Value), true
-		}
-		index -= inst.Sustain.Time
-		if index < inst.Release.Time {
-			return interpolate(index, inst.Release, inst.Sustain.Value), true
-		}
-	case EventOff:
-		if index < inst.Release.Time {
-			return interpolate(index, inst.Release, level), true
-		}
-	}
-
-	return 0, false
-}
-
-func (inst *Instrument) Mix(pitch float64, step float64, offset int64) float64 {
-	var sum float64
-	for i, v := range inst.Harmonics {
-		f := pitchToFreq(pitch)
-		h := f * float64(i+1)
-		if h > SamplingFrequency/2 {
-			break
-		}
-
-		atten := float64(1.0)
-		if inst.Attenuation.P1 > 0 {
-			p := pitch - inst.Attenuation.PitchOffset
-			p *= inst.Attenuation.P1 * p
-			atten = inst.Attenuation.P2 / (p*(float64(offset)/(inst.Attenuation.P3+1)+inst.Attenuation.P4) + 1)
-			if atten > 1 {
-				atten = 1
-			}
-			if atten < 1e-5 {
-				break
-			}
-		}
-
-		sum += v * math.Sin(step*h) * atten
-	}
-	return sum
-}
-
 type Channel struct {
 	Event      EventType
 	EventTime  int64
 	EventLevel float64
 	Pitch      float64
 	PrevLevel  float64
+	Velocity   float64
+
+	startTime int64       // startTime is the time of the latest EventOn
+	state     interface{} // state is private to the instrument of the channel
 }
 
 type Voice struct {
@@ -117,31 +36,67 @@ type Voice struct {
 	Instrument  int
 	VibratoFreq float64
 	VibratoAmp  float64
+	Pattern     Pattern // Pattern is how the voice plays chords
 
 	channels []Channel
 }
 
+// Update sets the parameters of the voice to those of p, keeping the notes
+// that are playing.
+func (v *Voice) Update(p Voice) {
+	channels := v.channels
+	*v = p
+	v.channels = channels
+}
+
+// Validate returns an error if the voice cannot be played with the number
+// of instruments.
+func (v *Voice) Validate(instruments int) error {
+	if v.Instrument < 0 || v.Instrument >= instruments {
+		return fmt.Errorf("instrument %d does not exist", v.Instrument)
+	}
+	if v.Level < 0 {
+		return fmt.Errorf("level %g is negative", v.Level)
+	}
+	if v.VibratoFreq < 0 || v.VibratoAmp < 0 {
+		return fmt.Errorf("vibrato cannot be negative")
+	}
+	if err := v.Pattern.Validate(); err != nil {
+		return fmt.Errorf("pattern: %v", err)
+	}
+	return nil
+}
+
 type Mix struct {
 	mutex sync.Mutex
 
 	index    int64 // index is the current time
 	seqIndex int64 // index in the current sequence
 
-	rem  []byte      // rem are the bytes that are ready to be read
-	bufC chan []byte // bufC is used to send the bytes to be read
+	sinks  sinks     // sinks receive the audio blocks
+	engine sync.Once // engine starts rendering for the sinks
 
 	seq     *Sequence // seq is the currently playing sequence
 	event   int       // event is the index of the next event
 	nextSeq *Sequence // nextSeq is played after the current sequence has finished
 
+	state TransportState // state is whether the mix is playing
+	loop  bool           // loop repeats seq instead of moving on to nextSeq
+
+	bus         Broadcaster // bus sends messages to subscribers
+	blockTime   int64       // blockTime is index at the end of the latest block, accessed atomically
+	voiceEnergy []float64   // voiceEnergy is the energy of each voice in the current block
+
+	dir string // dir is the directory of the configuration file, which file names are relative to
+
 	Level       float64 // master audio level
-	Instruments []Instrument
+	Instruments Instruments
 	Voices      []Voice
 }
 
 var wavHeader = []byte{
 	'R', 'I', 'F', 'F', // ChunkID
-	0, 0, 0, 0, // ChunkSize
+	0xFF, 0xFF, 0xFF, 0xFF, // ChunkSize
 	'W', 'A', 'V', 'E', // Format
 	'f', 'm', 't', ' ', // Subchunk1ID
 	0x10, 0x0, 0x0, 0x0, // Subchunk1Size PCM
@@ -155,26 +110,78 @@ var wavHeader = []byte{
 	0xFF, 0xFF, 0xFF, 0xFF, // Subchunk2Size
 }
 
+// WavHeader returns the header of a WAVE stream of the mix of unknown
+// length.
+func WavHeader() []byte {
+	return append([]byte(nil), wavHeader...)
+}
+
 func NewMix() *Mix {
-	return &Mix{
-		bufC: make(chan []byte),
-		rem:  wavHeader,
+	return &Mix{}
+}
+
+// ReadMixConfig reads and validates a mix configuration file.
+func ReadMixConfig(filename string) (*Mix, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	m, err := DecodeMixConfig(data, filepath.Dir(filename))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
 	}
+	return m, nil
 }
 
-func ReadMixConfig(filename string) *Mix {
+// DecodeMixConfig decodes and validates a mix configuration, and reads the
+// files of its instruments with names relative to dir.
+func DecodeMixConfig(data []byte, dir string) (*Mix, error) {
 	m := NewMix()
-
-	f, err := os.Open(filename)
-	if err != nil {
-		panic(err)
+	m.dir = dir
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
 	}
+	for i, inst := range m.Instruments {
+		if err := m.LoadInstrument(inst); err != nil {
+			return nil, fmt.Errorf("instrument %d: %v", i, err)
+		}
+	}
+	return m, nil
+}
 
-	if err := json.NewDecoder(f).Decode(m); err != nil {
-		panic(err)
+// LoadInstrument reads the files that an instrument plays, with names
+// relative to the configuration file of the mix. The mix need not be
+// locked.
+func (m *Mix) LoadInstrument(inst Instrument) error {
+	if l, ok := inst.(Loader); ok {
+		return l.Load(m.dir)
 	}
+	return nil
+}
 
-	return m
+// Validate returns an error if the configuration of the mix cannot be
+// played. The mix must be locked.
+func (m *Mix) Validate() error {
+	if m.Level < 0 {
+		return fmt.Errorf("level %g is negative", m.Level)
+	}
+	for i, inst := range m.Instruments {
+		if inst == nil {
+			return fmt.Errorf("instrument %d is missing", i)
+		}
+		if err := inst.Validate(); err != nil {
+			return fmt.Errorf("instrument %d: %v", i, err)
+		}
+	}
+	for i := range m.Voices {
+		if err := m.Voices[i].Validate(len(m.Instruments)); err != nil {
+			return fmt.Errorf("voice %d: %v", i, err)
+		}
+	}
+	return nil
 }
 
 func (m *Mix) Lock() {
@@ -185,21 +192,15 @@ func (m *Mix) Unlock() {
 	m.mutex.Unlock()
 }
 
-func (m *Mix) Play(out io.Writer) {
-	go m.Mix()
-
-	for {
-		io.CopyN(out, m, 1024)
-	}
-}
-
-func (m *Mix) Read(buf []byte) (int, error) {
-	if len(m.rem) == 0 {
-		m.rem = <-m.bufC
+// Play writes the mix to out as a WAVE stream, and returns when writing
+// fails. The mix waits for out.
+func (m *Mix) Play(out io.Writer) error {
+	if _, err := out.Write(wavHeader); err != nil {
+		return err
 	}
-	n := copy(buf, m.rem)
-	m.rem = m.rem[n:]
-	return n, nil
+	s := m.Attach(out, 1, OverflowBlock)
+	<-s.Done()
+	return s.Err()
 }
 
 func pitchToFreq(pitch float64) float64 {
@@ -210,10 +211,18 @@ func (m *Mix) fill(buf []float64) {
 	m.Lock()
 	defer m.Unlock()
 
-	if m.seqIndex == 0 {
+	if m.seq == nil {
 		m.event = 0
 		m.seqIndex = 0
 		m.seq = m.nextSeq
+		m.publishSequence()
+	}
+
+	if m.state != TransportPlaying || m.seq == nil {
+		for i := range buf {
+			buf[i] = 0
+		}
+		return
 	}
 
 	for i := range buf {
@@ -234,6 +243,9 @@ func (m *Mix) fill(buf []float64) {
 				if e.PitchFunc != nil {
 					pitch = e.PitchFunc()
 				}
+				if e.Voice < 0 || e.Voice >= len(m.Voices) {
+					break
+				}
 				v := &m.Voices[e.Voice]
 				if pitch != 0 {
 					var channel *Channel
@@ -249,12 +261,19 @@ func (m *Mix) fill(buf []float64) {
 							Pitch:     pitch,
 							Event:     e.Type,
 							EventTime: eventTime,
+							Velocity:  e.velocity(),
+							startTime: eventTime,
 						})
 					} else {
 						channel.Event = e.Type
 						channel.EventTime = eventTime
 						channel.EventLevel = channel.PrevLevel
+						if e.Type == EventOn {
+							channel.Velocity = e.velocity()
+							channel.startTime = eventTime
+						}
 					}
+					m.publishNote(&e, pitch)
 				}
 			}
 			if e.Func != nil {
@@ -264,84 +283,56 @@ func (m *Mix) fill(buf []float64) {
 			if m.event >= len(m.seq.Events) {
 				m.event = 0
 				m.seqIndex = 0
-				if m.nextSeq != nil {
+				if m.nextSeq != nil && !m.loop {
 					m.seq = m.nextSeq
 				}
+				m.publishSequence()
 			}
 		}
 
+		if len(m.voiceEnergy) != len(m.Voices) {
+			m.voiceEnergy = make([]float64, len(m.Voices))
+		}
+
 		s := float64(m.index) * SamplingInterval
 		var sum float64
 		for i, v := range m.Voices {
+			if v.Instrument < 0 || v.Instrument >= len(m.Instruments) {
+				continue
+			}
 			vib := v.VibratoAmp * math.Sin(v.VibratoFreq*s)
+			inst := m.Instruments[v.Instrument]
 			cs := v.channels[:0]
-			for j, c := range v.channels {
+			var vsum float64
+			for j := range v.channels {
+				c := &v.channels[j]
 				offset := m.index - c.EventTime
-				level, ok := m.Instruments[v.Instrument].Level(c.Event, offset, c.EventLevel)
+				level, ok := inst.Level(c.Event, offset, c.EventLevel)
 				if ok {
-					cs = append(cs, c)
-					v.channels[j].PrevLevel = level
-					sum += level * v.Level * m.Instruments[v.Instrument].Mix(c.Pitch, s+vib, offset)
+					c.PrevLevel = level
+					vsum += level * c.Velocity * v.Level * inst.Mix(c, s+vib, offset)
+					cs = append(cs, *c)
 				}
 			}
 			m.Voices[i].channels = cs
+			m.voiceEnergy[i] += vsum * vsum
+			sum += vsum
 		}
 		m.index++
 		m.seqIndex++
 
 		buf[i] = sum
 	}
+	atomic.StoreInt64(&m.blockTime, m.index)
 }
 
-func (m *Mix) Mix() {
-	const N = 16384
-	hann := dsp.Hann(N)
-	lowpass := dsp.Sinc(N, 600, 4000)
-	buf0 := make([]float64, N)
-	buf1 := make([]float64, N)
-	w1 := make([]float64, N)
-	w := make([]float64, N)
-	out0 := make([]float64, N)
-	out1 := make([]float64, N)
-	out := make([]float64, N)
-	for {
-		m.fill(buf1)
-
-		for i := range w1 {
-			w1[i] = hann[i] * buf1[i]
-		}
-
-		dsp.Convolve(out1, w1, lowpass)
-
-		for i := 0; i < N/2; i++ {
-			w[i] = hann[i] * buf0[i+N/2]
-		}
-		for i := N / 2; i < N; i++ {
-			w[i] = hann[i] * buf1[i-N/2]
-		}
-
-		dsp.Convolve(out, w, lowpass)
-
-		for i := 0; i < N/2; i++ {
-			out[i] += out0[i+N/2]
-		}
-		for i := N / 2; i < N; i++ {
-			out[i] += out1[i-N/2]
-		}
-
-		buf0, buf1 = buf1, buf0
-		out0, out1 = out1, out0
-
-		bytes := make([]byte, len(out)*2)
-		for i := range out {
-			t := uint16(N / 1024 * m.Level * out[i])
-			binary.LittleEndian.PutUint16(bytes[2*i:2*i+2], t)
-		}
-		m.bufC <- bytes
-	}
-}
-
+// SetNextSequence sets the sequence that is played after the current one.
+// It is meant to be called from the Func of an event, and takes the mix to
+// be locked. A sequence without a Name takes the name of the current one.
 func (m *Mix) SetNextSequence(s *Sequence) {
+	if s != nil && s.Name == "" && m.seq != nil {
+		s.Name = m.seq.Name
+	}
 	m.nextSeq = s
 }
 
@@ -359,9 +350,18 @@ type Event struct {
 	PitchFunc func() float64
 	Type      EventType
 	Voice     int
+	Velocity  float64 // Velocity of an EventOn in (0, 1], zero means 1
 	Func      func(*Mix)
 }
 
+func (e *Event) velocity() float64 {
+	if e.Velocity <= 0 {
+		return 1
+	}
+	return e.Velocity
+}
+
 type Sequence struct {
+	Name   string
 	Events []Event
 }
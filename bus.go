@@ -0,0 +1,282 @@
+package aujo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Types of messages.
+const (
+	MessageNoteOn     = "noteOn"
+	MessageNoteOff    = "noteOff"
+	MessageSequence   = "sequence"
+	MessageChord      = "chord"
+	MessageModulation = "modulation"
+	MessageMeter      = "meter"
+	MessageConfig     = "config"
+	MessageLog        = "log"
+)
+
+// LogTypes are the types of the messages about the music that the mix
+// plays and of the log of the program, which make up event logs and the
+// logs of recordings.
+var LogTypes = []string{
+	MessageSequence,
+	MessageChord,
+	MessageModulation,
+	MessageNoteOn,
+	MessageNoteOff,
+	MessageLog,
+}
+
+// Levels of log messages.
+const (
+	LogInfo    = "info"
+	LogWarning = "warning"
+	LogError   = "error"
+)
+
+// Message is a notification about the state of the mix. Data is one of the
+// message structs below, depending on Type.
+type Message struct {
+	Type string
+	Time int64 // Time of the mix when the message was sent
+	Data interface{}
+}
+
+// NoteMessage is sent when an event of a sequence starts or releases a
+// note.
+type NoteMessage struct {
+	Voice    int
+	Pitch    float64
+	Velocity float64
+	Sequence string
+	Event    int // Event is the index of the event in the sequence
+}
+
+// SequenceMessage is sent when a sequence starts.
+type SequenceMessage struct {
+	Name string
+}
+
+// ChordMessage is sent when a generated chord starts.
+type ChordMessage struct {
+	Key      string   // Key is the name of the key, like "A minor"
+	Chord    string   // Chord is the Roman numeral of the chord
+	Symbol   string   // Symbol is the chord symbol, like "Bm7"
+	Function string   // Function is the harmonic function of the chord
+	Notes    []string // Notes are the names of the voiced notes
+	Pitches  []float64
+}
+
+// ModulationMessage is sent when a generated progression changes key.
+type ModulationMessage struct {
+	Modulation string
+	From       string
+	To         string
+}
+
+// VoiceMeter is the activity of a voice during a block.
+type VoiceMeter struct {
+	Channels int     // Channels is the number of notes sounding
+	RMS      float64 // RMS is the level of the voice before filtering
+}
+
+// MeterMessage is sent after each block.
+type MeterMessage struct {
+	Peak      float64
+	RMS       float64
+	Voices    []VoiceMeter
+	Transport TransportStatus
+}
+
+// ConfigMessage is sent when a part of the configuration has changed.
+type ConfigMessage struct {
+	Resource string // Resource is "instrument", "voice", "master" or "mix"
+	Id       int
+}
+
+// LogMessage is sent when the program reports something, like an error
+// that it keeps running after.
+type LogMessage struct {
+	Level string
+	Text  string
+}
+
+// Broadcaster sends messages to subscribers without waiting for them.
+// Subscribers that do not keep up miss messages.
+type Broadcaster struct {
+	mutex sync.Mutex
+	subs  map[chan Message]struct{}
+	n     int32
+}
+
+// Subscribe returns a channel of messages with room for n messages, and a
+// function that cancels the subscription and closes the channel.
+func (b *Broadcaster) Subscribe(n int) (<-chan Message, func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.subs == nil {
+		b.subs = make(map[chan Message]struct{})
+	}
+	c := make(chan Message, n)
+	b.subs[c] = struct{}{}
+	atomic.AddInt32(&b.n, 1)
+
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			b.mutex.Lock()
+			defer b.mutex.Unlock()
+			delete(b.subs, c)
+			atomic.AddInt32(&b.n, -1)
+			close(c)
+		})
+	}
+}
+
+// Active returns whether there are any subscribers, so that senders can
+// avoid building messages nobody receives.
+func (b *Broadcaster) Active() bool {
+	return atomic.LoadInt32(&b.n) > 0
+}
+
+// Publish sends a message to the subscribers that have room for it.
+func (b *Broadcaster) Publish(msg Message) {
+	if !b.Active() {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for c := range b.subs {
+		select {
+		case c <- msg:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of messages about the mix, see
+// Broadcaster.Subscribe.
+func (m *Mix) Subscribe(n int) (<-chan Message, func()) {
+	return m.bus.Subscribe(n)
+}
+
+// Publish sends a message to the subscribers of the mix, with the time of
+// the latest block. It can be called whether or not the mix is locked.
+func (m *Mix) Publish(msg Message) {
+	msg.Time = atomic.LoadInt64(&m.blockTime)
+	m.bus.Publish(msg)
+}
+
+// Log publishes a log message of a level with the operands formatted like
+// fmt.Sprintln. It can be called whether or not the mix is locked.
+func (m *Mix) Log(level string, args ...interface{}) {
+	m.Publish(Message{
+		Type: MessageLog,
+		Data: LogMessage{
+			Level: level,
+			Text:  strings.TrimSuffix(fmt.Sprintln(args...), "\n"),
+		},
+	})
+}
+
+// PublishEvent sends a message at the time of the current event. It is
+// called from the Func of an Event, while the mix is locked.
+func (m *Mix) PublishEvent(typ string, data interface{}) {
+	if !m.bus.Active() {
+		return
+	}
+	m.bus.Publish(Message{
+		Type: typ,
+		Time: m.index,
+		Data: data,
+	})
+}
+
+// publishNote sends a message for an event. The mix must be locked.
+func (m *Mix) publishNote(e *Event, pitch float64) {
+	if !m.bus.Active() {
+		return
+	}
+	typ := MessageNoteOn
+	if e.Type == EventOff {
+		typ = MessageNoteOff
+	}
+	m.bus.Publish(Message{
+		Type: typ,
+		Time: m.index,
+		Data: NoteMessage{
+			Voice:    e.Voice,
+			Pitch:    pitch,
+			Velocity: e.velocity(),
+			Sequence: m.seq.Name,
+			Event:    m.event,
+		},
+	})
+}
+
+// publishSequence sends a message for the start of the current sequence.
+// The mix must be locked.
+func (m *Mix) publishSequence() {
+	if !m.bus.Active() || m.seq == nil {
+		return
+	}
+	m.bus.Publish(Message{
+		Type: MessageSequence,
+		Time: m.index,
+		Data: SequenceMessage{Name: m.seq.Name},
+	})
+}
+
+// publishMeter sends the levels of a rendered block, and resets the
+// levels of the voices.
+func (m *Mix) publishMeter(out []float64) {
+	if !m.bus.Active() {
+		m.Lock()
+		for i := range m.voiceEnergy {
+			m.voiceEnergy[i] = 0
+		}
+		m.Unlock()
+		return
+	}
+
+	var peak, energy float64
+	for _, v := range out {
+		if v > peak {
+			peak = v
+		} else if -v > peak {
+			peak = -v
+		}
+		energy += v * v
+	}
+
+	transport := m.Status()
+
+	m.Lock()
+	voices := make([]VoiceMeter, len(m.Voices))
+	for i := range m.Voices {
+		voices[i].Channels = len(m.Voices[i].channels)
+		if i < len(m.voiceEnergy) {
+			voices[i].RMS = math.Sqrt(m.voiceEnergy[i] / float64(len(out)))
+			m.voiceEnergy[i] = 0
+		}
+	}
+	m.Unlock()
+
+	m.bus.Publish(Message{
+		Type: MessageMeter,
+		Time: transport.Time,
+		Data: MeterMessage{
+			Peak:      peak,
+			RMS:       math.Sqrt(energy / float64(len(out))),
+			Voices:    voices,
+			Transport: transport,
+		},
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rwelin/aujo"
+	"github.com/rwelin/aujo/dsp/analysis"
+)
+
+// noteMix returns a mix that holds a single note of an instrument for
+// hold samples.
+func noteMix(m *aujo.Mix, inst int, pitch float64, hold int64) (*aujo.Mix, error) {
+	if inst < 0 || inst >= len(m.Instruments) {
+		return nil, fmt.Errorf("no such instrument %d", inst)
+	}
+	n := aujo.NewMix()
+	n.Level = m.Level
+	n.Instruments = m.Instruments
+	n.Voices = []aujo.Voice{{Level: 1, Instrument: inst}}
+	n.SetNextSequence(&aujo.Sequence{
+		Events: []aujo.Event{
+			{Time: 0, Type: aujo.EventOn, Pitch: pitch},
+			{Time: hold, Type: aujo.EventOff, Pitch: pitch},
+			{Time: 1 << 62},
+		},
+	})
+	return n, nil
+}
+
+func analyze(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	config := fs.String("config", ConfigFilename, "mix configuration")
+	inst := fs.Int("instrument", -1, "analyze a single note of this instrument instead of the mix")
+	pitch := fs.Float64("pitch", 69, "pitch of the note of -instrument")
+	hold := fs.Float64("hold", 1, "seconds before the note of -instrument is released")
+	seq := fs.String("sequence", "autochords", "sequence to render for the mix")
+	duration := fs.Float64("duration", 2, "seconds to render")
+	size := fs.Int("size", 4096, "samples per transform, a power of two")
+	hop := fs.Int("hop", 1024, "samples between frames")
+	spectrum := fs.Bool("spectrum", false, "write the average spectrum instead of a spectrogram")
+	format := fs.String("format", "csv", "output format, csv or png")
+	floor := fs.Float64("floor", -120, "lowest level in dB of the png")
+	out := fs.String("o", "-", "output file")
+	fs.Parse(args)
+
+	m, err := aujo.ReadMixConfig(*config)
+	if err != nil {
+		return err
+	}
+	if *inst >= 0 {
+		m, err = noteMix(m, *inst, *pitch, int64(*hold*aujo.SamplingFrequency))
+		if err != nil {
+			return err
+		}
+	} else {
+		s, err := aujo.NewSequence(*seq)
+		if err != nil {
+			return err
+		}
+		m.SetNextSequence(s)
+	}
+
+	x := m.Render(int(*duration * aujo.SamplingFrequency))
+
+	s, err := analysis.STFT(x, aujo.SamplingFrequency, *size, *hop)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch {
+	case *format == "csv" && *spectrum:
+		return analysis.WriteSpectrumCSV(w, s.Average(), s.SampleRate)
+	case *format == "csv":
+		return s.WriteCSV(w)
+	case *format == "png" && !*spectrum:
+		return s.WritePNG(w, *floor)
+	}
+	return fmt.Errorf("cannot write format %q", *format)
+}
@@ -1,75 +1,177 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/rwelin/aujo"
 	"github.com/rwelin/aujo/api"
-	"github.com/rwelin/aujo/examples"
+	"github.com/rwelin/aujo/config"
+	"github.com/rwelin/aujo/preset"
 )
 
-var major = []float64{69, 71, 73, 74, 76, 78, 80}
-var minor = []float64{69, 71, 72, 74, 76, 77, 79}
-var melMinor = []float64{69, 71, 72, 74, 76, 78, 80}
-var harMinor = []float64{69, 71, 72, 74, 75, 77, 80}
-
 const ConfigFilename = "config.json"
 
-type apiCallbacks struct {
-	m *aujo.Mix
-}
+// SaveDelay is how long changes to the mix wait to be saved, so that a
+// burst of changes is saved once.
+const SaveDelay = 500 * time.Millisecond
 
-func log(args ...interface{}) {
-	fmt.Fprintln(os.Stderr, args...)
-}
+// WatchInterval is how often the configuration file is checked for changes
+// made by hand.
+const WatchInterval = time.Second
 
-func (cb *apiCallbacks) UpdateInstrumentHarmonics(inst int, harm []float64) error {
-	config, err := ioutil.TempFile("", "aujoconfig")
-	if err != nil {
-		panic(err)
-	}
-	defer os.Remove(config.Name())
-	defer config.Close()
+// HistorySize is the number of changes that can be undone.
+const HistorySize = 100
 
-	cb.m.Lock()
-	defer cb.m.Unlock()
+// HistoryWindow is how close changes to the same part of the mix must
+// follow each other to be undone together.
+const HistoryWindow = time.Second
 
-	if inst >= len(cb.m.Instruments) {
-		return fmt.Errorf("no such instrument")
-	}
+// OriginsVariable is the environment variable that lists the origins of
+// other hosts that may use the API from a browser, separated by commas,
+// like "http://localhost:8080" or "*" for any. It defaults to
+// DefaultOrigins.
+const OriginsVariable = "AUJO_ORIGINS"
 
-	cb.m.Instruments[inst].Harmonics = harm
+// DefaultOrigins is the development server of the UI.
+const DefaultOrigins = "http://localhost:8080"
 
-	if err := json.NewEncoder(config).Encode(cb.m); err != nil {
-		panic(err)
+// origins returns the origins in OriginsVariable.
+func origins() []string {
+	list, ok := os.LookupEnv(OriginsVariable)
+	if !ok {
+		list = DefaultOrigins
 	}
-	if err := os.Rename(config.Name(), ConfigFilename); err != nil {
-		panic(err)
+	var allowed []string
+	for _, o := range strings.Split(list, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			allowed = append(allowed, o)
+		}
 	}
+	return allowed
+}
 
-	return nil
+// fatal reports an error that stops the program, and exits.
+func fatal(args ...interface{}) {
+	fmt.Fprintln(os.Stderr, args...)
+	os.Exit(1)
 }
 
-func (cb *apiCallbacks) Mix() ([]byte, error) {
-	cb.m.Lock()
-	defer cb.m.Unlock()
-	return json.Marshal(cb.m)
+// handleSignals starts and stops recording on SIGUSR1, and saves the
+// latest audio on SIGUSR2.
+func handleSignals(rec *recorder) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+	for sig := range c {
+		var r api.Recording
+		var err error
+		if sig == syscall.SIGUSR1 {
+			r, err = rec.Toggle()
+		} else {
+			r, err = rec.SaveRewind()
+		}
+		if err != nil {
+			rec.m.Log(aujo.LogError, "recording:", err)
+		} else if r.Active {
+			rec.m.Log(aujo.LogInfo, "recording to", r.Audio)
+		} else {
+			rec.m.Log(aujo.LogInfo, fmt.Sprintf("saved %.1f s to %s", r.Seconds, r.Audio))
+		}
+	}
 }
 
 func main() {
-	m := aujo.ReadMixConfig(ConfigFilename)
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "analyze":
+			err = analyze(os.Args[2:])
+		case "preset":
+			err = presetCommand(os.Args[2:])
+		default:
+			err = fmt.Errorf("unknown command %q", os.Args[1])
+		}
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	file := config.NewFile(ConfigFilename)
+	data, err := file.Read()
+	if err != nil {
+		fatal(err)
+	}
+	m, err := aujo.DecodeMixConfig(data, filepath.Dir(ConfigFilename))
+	if err != nil {
+		fatal(ConfigFilename+":", err)
+	}
 
-	m.SetNextSequence(examples.AutoChords())
+	startEventLog(m)
+	loadStyles(m)
+	loadDrums(m)
+
+	s, err := aujo.NewSequence("autochords")
+	if err != nil {
+		panic(err)
+	}
+	m.SetNextSequence(s)
 
-	go m.Play(os.Stdout)
+	// keep serving the other sinks when the player on stdout goes away
+	signal.Ignore(syscall.SIGPIPE)
+	go func() {
+		if err := m.Play(os.Stdout); err != nil {
+			m.Log(aujo.LogError, "stdout:", err)
+		}
+	}()
 
-	handler := api.NewHandler(&apiCallbacks{
-		m: m,
+	initial, err := m.Snapshot()
+	if err != nil {
+		panic(err)
+	}
+
+	rec := newRecorder(m)
+	go handleSignals(rec)
+
+	saver := config.NewSaver(file, SaveDelay, func() ([]byte, error) {
+		m.Lock()
+		defer m.Unlock()
+		return encodeConfig(m)
+	}, func(err error) {
+		m.Log(aujo.LogError, ConfigFilename+":", err)
 	})
 
+	cb := &apiCallbacks{
+		m:       m,
+		rec:     rec,
+		presets: preset.NewStore(PresetDirectory),
+		history: aujo.NewHistory(initial, HistorySize, HistoryWindow),
+		saver:   saver,
+	}
+	file.Watch(WatchInterval, cb.reload)
+
+	// finish the recording and save pending changes before exiting
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		<-c
+		err := rec.Close()
+		if err := saver.Flush(); err != nil {
+			fatal(ConfigFilename+":", err)
+		}
+		if err != nil {
+			fatal("recording:", err)
+		}
+		os.Exit(0)
+	}()
+
+	handler := api.NewHandler(cb, origins()...)
+
 	panic(http.ListenAndServe(":7999", handler))
 }
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rwelin/aujo"
+	"github.com/rwelin/aujo/api"
+	"github.com/rwelin/aujo/config"
+	"github.com/rwelin/aujo/preset"
+)
+
+type apiCallbacks struct {
+	m       *aujo.Mix
+	rec     *recorder
+	presets *preset.Store
+	history *aujo.History
+	saver   *config.Saver
+}
+
+// encodeConfig returns the configuration file of a mix, indented for
+// editing by hand. The mix must be locked.
+func encodeConfig(m *aujo.Mix) ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// commit adds a change of the mix to the history, saves the mix and tells
+// the subscribers which part of it has changed. The mix must be locked.
+func (cb *apiCallbacks) commit(resource string, id int) error {
+	state, err := cb.m.Snapshot()
+	if err != nil {
+		return err
+	}
+	cb.history.Add(fmt.Sprintf("%s %d", resource, id), state)
+	cb.persist(resource, id)
+	return nil
+}
+
+// persist schedules saving the mix, and tells the subscribers which part of
+// it has changed. The mix must be locked.
+func (cb *apiCallbacks) persist(resource string, id int) {
+	cb.saver.Save()
+	cb.notify(resource, id)
+}
+
+// notify tells the subscribers which part of the mix has changed.
+func (cb *apiCallbacks) notify(resource string, id int) {
+	cb.m.Publish(aujo.Message{
+		Type: aujo.MessageConfig,
+		Data: aujo.ConfigMessage{
+			Resource: resource,
+			Id:       id,
+		},
+	})
+}
+
+// reload replaces the mix with the configuration file after it was edited
+// by hand. Invalid files are ignored.
+func (cb *apiCallbacks) reload(data []byte) {
+	n, err := cb.m.Decode(data)
+	if err != nil {
+		cb.m.Log(aujo.LogError, ConfigFilename+":", err)
+		return
+	}
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	cb.m.Apply(n)
+	if state, err := cb.m.Snapshot(); err == nil {
+		cb.history.Add("file", state)
+	}
+	cb.notify("mix", 0)
+	cb.m.Log(aujo.LogInfo, "reloaded", ConfigFilename)
+}
+
+// instrument returns the instrument with the id. The mix must be locked.
+func (cb *apiCallbacks) instrument(id int) (aujo.Instrument, error) {
+	if id < 0 || id >= len(cb.m.Instruments) {
+		return nil, fmt.Errorf("instrument %d: %w", id, api.ErrNotFound)
+	}
+	return cb.m.Instruments[id], nil
+}
+
+func (cb *apiCallbacks) UpdateInstrumentHarmonics(inst int, harm []float64) error {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	i, err := cb.instrument(inst)
+	if err != nil {
+		return err
+	}
+
+	a, ok := i.(*aujo.Additive)
+	if !ok {
+		return fmt.Errorf("instrument %d is not additive", inst)
+	}
+	a.Harmonics = harm
+
+	return cb.commit("instrument", inst)
+}
+
+func (cb *apiCallbacks) Instruments() (aujo.Instruments, error) {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	is := make(aujo.Instruments, len(cb.m.Instruments))
+	for i, inst := range cb.m.Instruments {
+		c, err := aujo.CopyInstrument(inst)
+		if err != nil {
+			return nil, err
+		}
+		is[i] = c
+	}
+	return is, nil
+}
+
+func (cb *apiCallbacks) Instrument(id int) (aujo.Instrument, error) {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	inst, err := cb.instrument(id)
+	if err != nil {
+		return nil, err
+	}
+	return aujo.CopyInstrument(inst)
+}
+
+func (cb *apiCallbacks) AddInstrument(inst aujo.Instrument) (int, error) {
+	if err := cb.m.LoadInstrument(inst); err != nil {
+		return 0, err
+	}
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	cb.m.Instruments = append(cb.m.Instruments, inst)
+	return len(cb.m.Instruments) - 1, cb.commit("instrument", len(cb.m.Instruments)-1)
+}
+
+func (cb *apiCallbacks) UpdateInstrument(id int, inst aujo.Instrument) error {
+	if err := cb.m.LoadInstrument(inst); err != nil {
+		return err
+	}
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	if _, err := cb.instrument(id); err != nil {
+		return err
+	}
+	cb.m.Instruments[id] = inst
+	return cb.commit("instrument", id)
+}
+
+func (cb *apiCallbacks) PatchInstrument(id int, patch []byte) (aujo.Instrument, error) {
+	cb.m.Lock()
+	inst, err := cb.instrument(id)
+	var p aujo.Instrument
+	if err == nil {
+		p, err = aujo.PatchInstrument(inst, patch)
+	}
+	cb.m.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cb.m.LoadInstrument(p); err != nil {
+		return nil, err
+	}
+
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	if cur, err := cb.instrument(id); err != nil {
+		return nil, err
+	} else if cur != inst {
+		return nil, fmt.Errorf("instrument %d changed while it was patched: %w", id, api.ErrConflict)
+	}
+	cb.m.Instruments[id] = p
+	if err := cb.commit("instrument", id); err != nil {
+		return nil, err
+	}
+	return aujo.CopyInstrument(p)
+}
+
+// DeleteInstrument removes an instrument that no voice plays, and moves the
+// references to the following instruments.
+func (cb *apiCallbacks) DeleteInstrument(id int) error {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	if _, err := cb.instrument(id); err != nil {
+		return err
+	}
+	for i, v := range cb.m.Voices {
+		if v.Instrument == id {
+			return fmt.Errorf("instrument %d is played by voice %d: %w", id, i, api.ErrConflict)
+		}
+	}
+
+	cb.m.Instruments = append(cb.m.Instruments[:id], cb.m.Instruments[id+1:]...)
+	for i := range cb.m.Voices {
+		if cb.m.Voices[i].Instrument > id {
+			cb.m.Voices[i].Instrument--
+		}
+	}
+	return cb.commit("instrument", id)
+}
+
+func (cb *apiCallbacks) Mix() ([]byte, error) {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+	return json.Marshal(cb.m)
+}
+
+// voice returns the voice with the id. The mix must be locked.
+func (cb *apiCallbacks) voice(id int) (*aujo.Voice, error) {
+	if id < 0 || id >= len(cb.m.Voices) {
+		return nil, fmt.Errorf("voice %d: %w", id, api.ErrNotFound)
+	}
+	return &cb.m.Voices[id], nil
+}
+
+func (cb *apiCallbacks) Voices() ([]aujo.Voice, error) {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	vs := make([]aujo.Voice, len(cb.m.Voices))
+	for i, v := range cb.m.Voices {
+		vs[i].Update(v)
+	}
+	return vs, nil
+}
+
+func (cb *apiCallbacks) Voice(id int) (aujo.Voice, error) {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	var ret aujo.Voice
+	v, err := cb.voice(id)
+	if err != nil {
+		return ret, err
+	}
+	ret.Update(*v)
+	return ret, nil
+}
+
+func (cb *apiCallbacks) AddVoice(v aujo.Voice) (int, error) {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	if err := v.Validate(len(cb.m.Instruments)); err != nil {
+		return 0, err
+	}
+	var nv aujo.Voice
+	nv.Update(v)
+	cb.m.Voices = append(cb.m.Voices, nv)
+	return len(cb.m.Voices) - 1, cb.commit("voice", len(cb.m.Voices)-1)
+}
+
+func (cb *apiCallbacks) UpdateVoice(id int, v aujo.Voice) error {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	cur, err := cb.voice(id)
+	if err != nil {
+		return err
+	}
+	if err := v.Validate(len(cb.m.Instruments)); err != nil {
+		return err
+	}
+	cur.Update(v)
+	return cb.commit("voice", id)
+}
+
+func (cb *apiCallbacks) PatchVoice(id int, patch []byte) (aujo.Voice, error) {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	var p aujo.Voice
+	cur, err := cb.voice(id)
+	if err != nil {
+		return p, err
+	}
+	p.Update(*cur)
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return p, err
+	}
+	if err := p.Validate(len(cb.m.Instruments)); err != nil {
+		return p, err
+	}
+	cur.Update(p)
+	return p, cb.commit("voice", id)
+}
+
+// DeleteVoice removes a voice. Sequences that play the removed voice or
+// voices after it are not changed.
+func (cb *apiCallbacks) DeleteVoice(id int) error {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	if _, err := cb.voice(id); err != nil {
+		return err
+	}
+	cb.m.Voices = append(cb.m.Voices[:id], cb.m.Voices[id+1:]...)
+	return cb.commit("voice", id)
+}
+
+func (cb *apiCallbacks) Master() (api.Master, error) {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+	return api.Master{Level: cb.m.Level}, nil
+}
+
+func (cb *apiCallbacks) UpdateMaster(m api.Master) error {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	if m.Level < 0 {
+		return fmt.Errorf("level %g is negative", m.Level)
+	}
+	cb.m.Level = m.Level
+	return cb.commit("master", 0)
+}
+
+func (cb *apiCallbacks) Transport() (aujo.TransportStatus, error) {
+	return cb.m.Status(), nil
+}
+
+func (cb *apiCallbacks) Play() error {
+	cb.m.Start()
+	return nil
+}
+
+func (cb *apiCallbacks) Pause() error {
+	cb.m.Pause()
+	return nil
+}
+
+func (cb *apiCallbacks) Stop() error {
+	cb.m.Stop()
+	return nil
+}
+
+func (cb *apiCallbacks) SetPosition(position int64) error {
+	return cb.m.SetPosition(position)
+}
+
+func (cb *apiCallbacks) SetLoop(loop bool) error {
+	cb.m.SetLoop(loop)
+	return nil
+}
+
+func (cb *apiCallbacks) SetSequence(name string, next bool) error {
+	s, err := aujo.NewSequence(name)
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, api.ErrNotFound)
+	}
+	if next {
+		cb.m.Lock()
+		cb.m.SetNextSequence(s)
+		cb.m.Unlock()
+	} else {
+		cb.m.SetSequence(s)
+	}
+	return nil
+}
+
+func (cb *apiCallbacks) Sequences() ([]string, error) {
+	return aujo.SequenceNames(), nil
+}
+
+func (cb *apiCallbacks) Subscribe() (<-chan aujo.Message, func()) {
+	return cb.m.Subscribe(256)
+}
+
+func (cb *apiCallbacks) Attach(w io.Writer) *aujo.Sink {
+	return cb.m.Attach(w, 4, aujo.OverflowDropOldest)
+}
+
+// presetErr marks missing presets as not found for the API.
+func presetErr(err error) error {
+	if errors.Is(err, preset.ErrNotFound) {
+		return fmt.Errorf("%v: %w", err, api.ErrNotFound)
+	}
+	return err
+}
+
+func (cb *apiCallbacks) Presets() ([]string, error) {
+	return cb.presets.List()
+}
+
+func (cb *apiCallbacks) Preset(name string) (aujo.Instrument, error) {
+	inst, err := cb.presets.Load(name)
+	return inst, presetErr(err)
+}
+
+func (cb *apiCallbacks) SavePreset(name string, instrument int) error {
+	cb.m.Lock()
+	inst, err := cb.instrument(instrument)
+	if err == nil {
+		inst, err = aujo.CopyInstrument(inst)
+	}
+	cb.m.Unlock()
+	if err != nil {
+		return err
+	}
+	return cb.presets.Save(name, inst)
+}
+
+func (cb *apiCallbacks) LoadPreset(instrument int, name string) (aujo.Instrument, error) {
+	inst, err := cb.presets.Load(name)
+	if err != nil {
+		return nil, presetErr(err)
+	}
+	if err := inst.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cb.UpdateInstrument(instrument, inst); err != nil {
+		return nil, err
+	}
+	return cb.Instrument(instrument)
+}
+
+func (cb *apiCallbacks) DeletePreset(name string) error {
+	return presetErr(cb.presets.Delete(name))
+}
+
+func (cb *apiCallbacks) DiffPresets(a string, b string) ([]preset.Change, error) {
+	changes, err := cb.presets.Diff(a, b)
+	return changes, presetErr(err)
+}
+
+func (cb *apiCallbacks) History() (api.History, error) {
+	steps, pos := cb.history.Steps()
+	return api.History{
+		Steps:    steps,
+		Position: pos,
+	}, nil
+}
+
+// restore replaces the mix with a state from the history by undo or redo.
+// restore moves d steps through the history. The files of the state are
+// read before the mix is locked.
+func (cb *apiCallbacks) restore(d int) (api.History, error) {
+	state, err := cb.history.Peek(d)
+	if errors.Is(err, aujo.ErrNoHistory) {
+		return api.History{}, fmt.Errorf("%v: %w", err, api.ErrConflict)
+	} else if err != nil {
+		return api.History{}, err
+	}
+	n, err := cb.m.Decode(state)
+	if err != nil {
+		return api.History{}, err
+	}
+
+	cb.m.Lock()
+	err = cb.history.Move(d, state)
+	if err == nil {
+		cb.m.Apply(n)
+		cb.persist("mix", 0)
+	}
+	cb.m.Unlock()
+	if errors.Is(err, aujo.ErrHistoryChanged) {
+		return api.History{}, fmt.Errorf("%v: %w", err, api.ErrConflict)
+	} else if err != nil {
+		return api.History{}, err
+	}
+	return cb.History()
+}
+
+func (cb *apiCallbacks) Undo() (api.History, error) {
+	return cb.restore(-1)
+}
+
+func (cb *apiCallbacks) Redo() (api.History, error) {
+	return cb.restore(1)
+}
+
+func (cb *apiCallbacks) Recording() (api.Recording, error) {
+	return cb.rec.Status(), nil
+}
+
+func (cb *apiCallbacks) StartRecording() (api.Recording, error) {
+	return cb.rec.Start()
+}
+
+func (cb *apiCallbacks) StopRecording() (api.Recording, error) {
+	return cb.rec.Stop()
+}
+
+func (cb *apiCallbacks) SaveRewind() (api.Recording, error) {
+	return cb.rec.SaveRewind()
+}
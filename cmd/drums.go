@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/rwelin/aujo"
+	"github.com/rwelin/aujo/drums"
+)
+
+// DrumDirectory is where drum patterns are read from at startup. A pattern
+// with the name of a built in pattern replaces it.
+const DrumDirectory = "drum-patterns"
+
+// loadDrums registers the drum patterns in DrumDirectory.
+func loadDrums(m *aujo.Mix) {
+	files, err := filepath.Glob(filepath.Join(DrumDirectory, "*.json"))
+	if err != nil {
+		m.Log(aujo.LogError, err)
+		return
+	}
+	for _, f := range files {
+		p, err := drums.Load(f)
+		if err == nil {
+			err = drums.Register(p)
+		}
+		if err != nil {
+			m.Log(aujo.LogError, err)
+			continue
+		}
+		m.Log(aujo.LogInfo, "loaded drum pattern", p.Name)
+	}
+}
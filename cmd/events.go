@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/rwelin/aujo"
+)
+
+// EventLogVariable is the environment variable that names where the event
+// log is written: a file, "-" for stderr, or a socket like
+// "tcp:localhost:9000" or "unix:/tmp/aujo.sock". Without it the music is
+// not logged.
+const EventLogVariable = "AUJO_EVENT_LOG"
+
+// openEventLog returns the writer of an event log destination.
+func openEventLog(dest string) (io.Writer, error) {
+	if dest == "-" {
+		return os.Stderr, nil
+	}
+	for _, network := range []string{"tcp", "unix"} {
+		if strings.HasPrefix(dest, network+":") {
+			return net.Dial(network, strings.TrimPrefix(dest, network+":"))
+		}
+	}
+	return os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+// startEventLog writes the music that the mix plays and the log of the
+// program to the destination in EventLogVariable. Without one, or once it
+// fails, the log of the program is written to stderr.
+func startEventLog(m *aujo.Mix) {
+	dest := os.Getenv(EventLogVariable)
+	if dest == "" {
+		m.NewEventLog(os.Stderr, aujo.MessageLog)
+		return
+	}
+	w, err := openEventLog(dest)
+	if err != nil {
+		m.NewEventLog(os.Stderr, aujo.MessageLog)
+		m.Log(aujo.LogError, "event log:", err)
+		return
+	}
+	l := m.NewEventLog(w)
+	go func() {
+		<-l.Done()
+		err := l.Close()
+		m.NewEventLog(os.Stderr, aujo.MessageLog)
+		m.Log(aujo.LogError, "event log:", err)
+	}()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/rwelin/aujo"
+	"github.com/rwelin/aujo/config"
+	"github.com/rwelin/aujo/preset"
+)
+
+// PresetDirectory is where instrument presets are stored.
+const PresetDirectory = "presets"
+
+const presetUsage = `usage: aujo preset list
+       aujo preset save <instrument> <name>
+       aujo preset load <name> <instrument>
+       aujo preset diff <name> <name>`
+
+func presetCommand(args []string) error {
+	if len(args) < 1 {
+		return errors.New(presetUsage)
+	}
+	fs := flag.NewFlagSet("preset "+args[0], flag.ExitOnError)
+	configFile := fs.String("config", ConfigFilename, "mix configuration")
+	dir := fs.String("dir", PresetDirectory, "preset directory")
+	fs.Parse(args[1:])
+	store := preset.NewStore(*dir)
+
+	switch {
+	case args[0] == "list" && fs.NArg() == 0:
+		names, err := store.List()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			inst, err := store.Load(name)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\t%s\n", name, inst.Type())
+		}
+		return nil
+
+	case args[0] == "save" && fs.NArg() == 2:
+		id, err := strconv.Atoi(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		m, err := aujo.ReadMixConfig(*configFile)
+		if err != nil {
+			return err
+		}
+		if id < 0 || id >= len(m.Instruments) {
+			return fmt.Errorf("no such instrument %d", id)
+		}
+		return store.Save(fs.Arg(1), m.Instruments[id])
+
+	case args[0] == "load" && fs.NArg() == 2:
+		id, err := strconv.Atoi(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		inst, err := store.Load(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if err := inst.Validate(); err != nil {
+			return err
+		}
+		m, err := aujo.ReadMixConfig(*configFile)
+		if err != nil {
+			return err
+		}
+		if id < 0 || id >= len(m.Instruments) {
+			return fmt.Errorf("no such instrument %d", id)
+		}
+		m.Instruments[id] = inst
+		data, err := encodeConfig(m)
+		if err != nil {
+			return err
+		}
+		return config.WriteFile(*configFile, data)
+
+	case args[0] == "diff" && fs.NArg() == 2:
+		changes, err := store.Diff(fs.Arg(0), fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+		return nil
+	}
+	return errors.New(presetUsage)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rwelin/aujo"
+	"github.com/rwelin/aujo/api"
+)
+
+// RecordingDirectory is where recordings are saved.
+const RecordingDirectory = "recordings"
+
+// RewindDuration is how much of the latest audio can be saved after it
+// was played.
+const RewindDuration = 5 * time.Minute
+
+// recorder records the mix to files, one recording at a time.
+type recorder struct {
+	m      *aujo.Mix
+	rewind *aujo.Rewind
+
+	mutex  sync.Mutex
+	rec    *aujo.Recording
+	audio  *os.File
+	events *os.File
+	last   api.Recording
+}
+
+func newRecorder(m *aujo.Mix) *recorder {
+	return &recorder{
+		m:      m,
+		rewind: m.Rewind(int(RewindDuration.Seconds() * aujo.SamplingFrequency)),
+	}
+}
+
+// create opens the audio and event files of a new recording.
+func create(prefix string) (*os.File, *os.File, error) {
+	if err := os.MkdirAll(RecordingDirectory, 0755); err != nil {
+		return nil, nil, err
+	}
+	name := filepath.Join(RecordingDirectory, prefix+time.Now().Format("20060102-150405"))
+	audio, err := os.Create(name + ".wav")
+	if err != nil {
+		return nil, nil, err
+	}
+	events, err := os.Create(name + ".jsonl")
+	if err != nil {
+		audio.Close()
+		return nil, nil, err
+	}
+	return audio, events, nil
+}
+
+func seconds(samples int64) float64 {
+	return float64(samples) / aujo.SamplingFrequency
+}
+
+// status returns the current or latest recording. The recorder must be
+// locked.
+func (r *recorder) status() api.Recording {
+	if r.rec == nil {
+		return r.last
+	}
+	select {
+	case <-r.rec.Done():
+		// writing failed
+		if err := r.finish(); err != nil {
+			r.m.Log(aujo.LogError, "recording:", err)
+		}
+		return r.last
+	default:
+	}
+	return api.Recording{
+		Active:  true,
+		Audio:   r.audio.Name(),
+		Events:  r.events.Name(),
+		Seconds: seconds(r.rec.Samples()),
+		Dropped: r.rec.Dropped(),
+	}
+}
+
+// finish stops the current recording and closes its files. The recorder
+// must be locked.
+func (r *recorder) finish() error {
+	err := r.rec.Stop()
+	r.last = api.Recording{
+		Audio:   r.audio.Name(),
+		Events:  r.events.Name(),
+		Seconds: seconds(r.rec.Samples()),
+		Dropped: r.rec.Dropped(),
+	}
+	if n := r.last.Dropped; n > 0 && err == nil {
+		err = fmt.Errorf("%d blocks were dropped from %s", n, r.audio.Name())
+	}
+	if cerr := r.audio.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := r.events.Close(); err == nil {
+		err = cerr
+	}
+	r.rec = nil
+	r.audio = nil
+	r.events = nil
+	return err
+}
+
+func (r *recorder) Status() api.Recording {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.status()
+}
+
+func (r *recorder) Start() (api.Recording, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.status().Active {
+		return r.status(), fmt.Errorf("already recording to %s: %w", r.audio.Name(), api.ErrConflict)
+	}
+	audio, events, err := create("")
+	if err != nil {
+		return r.last, err
+	}
+	rec, err := r.m.Record(audio, events)
+	if err != nil {
+		audio.Close()
+		events.Close()
+		return r.last, err
+	}
+	r.rec = rec
+	r.audio = audio
+	r.events = events
+	return r.status(), nil
+}
+
+func (r *recorder) Stop() (api.Recording, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.status().Active {
+		return r.last, fmt.Errorf("not recording: %w", api.ErrConflict)
+	}
+	err := r.finish()
+	return r.last, err
+}
+
+// Close stops the current recording, if any, so that its files are
+// complete.
+func (r *recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.rec == nil {
+		return nil
+	}
+	return r.finish()
+}
+
+// Toggle starts a recording, or stops the current one.
+func (r *recorder) Toggle() (api.Recording, error) {
+	rec, err := r.Start()
+	if errors.Is(err, api.ErrConflict) {
+		return r.Stop()
+	}
+	return rec, err
+}
+
+// SaveRewind saves the latest audio to new files.
+func (r *recorder) SaveRewind() (api.Recording, error) {
+	audio, events, err := create("rewind-")
+	if err != nil {
+		return api.Recording{}, err
+	}
+	defer audio.Close()
+	defer events.Close()
+
+	n, err := r.rewind.Save(audio, events)
+	if err != nil {
+		return api.Recording{}, err
+	}
+	if err := audio.Close(); err != nil {
+		return api.Recording{}, err
+	}
+	if err := events.Close(); err != nil {
+		return api.Recording{}, err
+	}
+	return api.Recording{
+		Audio:   audio.Name(),
+		Events:  events.Name(),
+		Seconds: seconds(n),
+	}, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/rwelin/aujo"
+	"github.com/rwelin/aujo/examples"
+	"github.com/rwelin/aujo/harmony"
+)
+
+// StyleDirectory is where progression styles are read from at startup.
+const StyleDirectory = "styles"
+
+// loadStyles registers a sequence autochords-<name> for each style in
+// StyleDirectory.
+func loadStyles(m *aujo.Mix) {
+	files, err := filepath.Glob(filepath.Join(StyleDirectory, "*.json"))
+	if err != nil {
+		m.Log(aujo.LogError, err)
+		return
+	}
+	for _, f := range files {
+		s, err := harmony.LoadStyle(f)
+		if err != nil {
+			m.Log(aujo.LogError, err)
+			continue
+		}
+		if s.Name == "" {
+			s.Name = filepath.Base(f[:len(f)-len(".json")])
+		}
+		aujo.RegisterSequence("autochords-"+s.Name, func() *aujo.Sequence {
+			return examples.AutoChordsStyle(s, examples.MelodyVoice)
+		})
+		m.Log(aujo.LogInfo, "loaded style", s.Name)
+	}
+}
@@ -0,0 +1,222 @@
+// Package config keeps configuration files on disk: it writes them
+// atomically, batches bursts of changes, and notices when they are edited
+// by others.
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// WriteFile replaces the named file with data, so that readers see either
+// the old or the new contents even if writing fails or the system crashes.
+func WriteFile(name string, data []byte) error {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+
+	// the temporary file must be on the same file system to be renamed
+	f, err := ioutil.TempFile(dir, "."+base)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if fi, err := os.Stat(name); err == nil {
+		f.Chmod(fi.Mode().Perm())
+	} else {
+		f.Chmod(0644)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return err
+	}
+
+	// make the rename itself durable
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	d.Sync()
+	return nil
+}
+
+// File is a configuration file that is changed both by the program and by
+// others.
+type File struct {
+	Name string
+
+	mutex sync.Mutex
+	sum   [sha256.Size]byte // sum is of the contents last read or written
+	mtime time.Time
+	size  int64
+}
+
+func NewFile(name string) *File {
+	return &File{Name: name}
+}
+
+// seen records the contents of the file as known. The file must be
+// locked.
+func (f *File) seen(data []byte) {
+	f.sum = sha256.Sum256(data)
+	if fi, err := os.Stat(f.Name); err == nil {
+		f.mtime = fi.ModTime()
+		f.size = fi.Size()
+	}
+}
+
+// Read returns the contents of the file.
+func (f *File) Read() ([]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	data, err := ioutil.ReadFile(f.Name)
+	if err != nil {
+		return nil, err
+	}
+	f.seen(data)
+	return data, nil
+}
+
+// Write replaces the contents of the file, see WriteFile.
+func (f *File) Write(data []byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := WriteFile(f.Name, data); err != nil {
+		return err
+	}
+	f.seen(data)
+	return nil
+}
+
+// changed returns the contents of the file if they differ from what was
+// last read or written.
+func (f *File) changed() ([]byte, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	fi, err := os.Stat(f.Name)
+	if err != nil || (fi.ModTime().Equal(f.mtime) && fi.Size() == f.size) {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(f.Name)
+	if err != nil {
+		return nil, false
+	}
+	sum := sha256.Sum256(data)
+	if bytes.Equal(sum[:], f.sum[:]) {
+		f.mtime = fi.ModTime()
+		f.size = fi.Size()
+		return nil, false
+	}
+	f.seen(data)
+	return data, true
+}
+
+// Watch checks the file for changes by others every interval, and calls
+// changed with the new contents. Writes through f are not reported. It
+// returns a function that stops watching.
+func (f *File) Watch(interval time.Duration, changed func(data []byte)) func() {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if data, ok := f.changed(); ok {
+					changed(data)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// Saver writes a file a while after the latest of a burst of changes.
+type Saver struct {
+	file   *File
+	delay  time.Duration
+	encode func() ([]byte, error)
+	failed func(error)
+
+	mutex   sync.Mutex // mutex protects timer
+	timer   *time.Timer
+	writing sync.Mutex // writing keeps writes in order
+}
+
+// NewSaver returns a saver that writes what encode returns to file, delay
+// after the latest call to Save. Errors of delayed saves are passed to
+// failed.
+func NewSaver(file *File, delay time.Duration, encode func() ([]byte, error), failed func(error)) *Saver {
+	return &Saver{
+		file:   file,
+		delay:  delay,
+		encode: encode,
+		failed: failed,
+	}
+}
+
+// Save schedules a write.
+func (s *Saver) Save() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.timer != nil {
+		s.timer.Reset(s.delay)
+		return
+	}
+	s.timer = time.AfterFunc(s.delay, func() {
+		if err := s.Flush(); err != nil {
+			s.failed(err)
+		}
+	})
+}
+
+// Flush writes the file now if a write is scheduled. Save may be called
+// while encode runs, but Flush may not.
+func (s *Saver) Flush() error {
+	s.writing.Lock()
+	defer s.writing.Unlock()
+
+	s.mutex.Lock()
+	scheduled := s.timer != nil
+	if scheduled {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.mutex.Unlock()
+	if !scheduled {
+		return nil
+	}
+
+	data, err := s.encode()
+	if err != nil {
+		return err
+	}
+	return s.file.Write(data)
+}
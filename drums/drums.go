@@ -0,0 +1,135 @@
+// Package drums sequences percussion voices from grids of steps, one bar
+// per chord of a progression.
+package drums
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Track is the steps of one drum of a pattern.
+type Track struct {
+	Voice int
+	Pitch float64
+	// Velocity is the velocity of each step, zero for none.
+	Velocity []float64
+	// Probability is the chance that each step plays, or always when
+	// empty.
+	Probability []float64
+}
+
+// Pattern is a bar of steps for a set of drums.
+type Pattern struct {
+	Name   string
+	Steps  int // Steps is the number of steps in a bar, 16 or 32
+	Tracks []Track
+	// Fill is a pattern that replaces the last bar of every FillEvery bars.
+	Fill      string
+	FillEvery int
+	// Next is a pattern that follows after Bars bars. Without it the
+	// pattern repeats.
+	Next string
+	Bars int
+}
+
+// Validate returns an error if the pattern cannot be played.
+func (p *Pattern) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("pattern has no name")
+	}
+	if p.Steps != 16 && p.Steps != 32 {
+		return fmt.Errorf("pattern %s: %d steps, not 16 or 32", p.Name, p.Steps)
+	}
+	for i, t := range p.Tracks {
+		if t.Voice < 0 {
+			return fmt.Errorf("pattern %s: track %d: voice %d is negative", p.Name, i, t.Voice)
+		}
+		if len(t.Velocity) != p.Steps {
+			return fmt.Errorf("pattern %s: track %d: %d velocities for %d steps", p.Name, i, len(t.Velocity), p.Steps)
+		}
+		if len(t.Probability) != 0 && len(t.Probability) != p.Steps {
+			return fmt.Errorf("pattern %s: track %d: %d probabilities for %d steps", p.Name, i, len(t.Probability), p.Steps)
+		}
+		for j, v := range t.Velocity {
+			if v < 0 || v > 1 {
+				return fmt.Errorf("pattern %s: track %d: velocity of step %d is not in [0, 1]", p.Name, i, j)
+			}
+		}
+		for j, v := range t.Probability {
+			if v < 0 || v > 1 {
+				return fmt.Errorf("pattern %s: track %d: probability of step %d is not in [0, 1]", p.Name, i, j)
+			}
+		}
+	}
+	if p.FillEvery < 0 || p.Bars < 0 {
+		return fmt.Errorf("pattern %s: bars cannot be negative", p.Name)
+	}
+	return nil
+}
+
+var patterns = struct {
+	sync.Mutex
+	byName map[string]*Pattern
+}{byName: make(map[string]*Pattern)}
+
+// Register makes a pattern available by name, replacing any pattern of
+// the same name.
+func Register(p *Pattern) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	patterns.Lock()
+	defer patterns.Unlock()
+	patterns.byName[p.Name] = p
+	return nil
+}
+
+// Named returns a registered pattern.
+func Named(name string) (*Pattern, error) {
+	patterns.Lock()
+	defer patterns.Unlock()
+	p, ok := patterns.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown drum pattern %q", name)
+	}
+	return p, nil
+}
+
+// Names returns the names of the registered patterns in order.
+func Names() []string {
+	patterns.Lock()
+	defer patterns.Unlock()
+	var names []string
+	for name := range patterns.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load reads a pattern from a JSON file. A pattern without a name is
+// named after the file.
+func Load(filename string) (*Pattern, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var p Pattern
+	if err := json.NewDecoder(f).Decode(&p); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return &p, nil
+}
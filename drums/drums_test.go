@@ -0,0 +1,125 @@
+package drums
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rwelin/aujo"
+)
+
+// marker is a pattern with one hit on its first step, at a pitch that
+// tells which pattern played a bar.
+func marker(name string, pitch float64) *Pattern {
+	return &Pattern{
+		Name:   name,
+		Steps:  16,
+		Tracks: []Track{{Pitch: pitch, Velocity: grid("9...............")}},
+	}
+}
+
+func TestSequencer(t *testing.T) {
+	names := map[float64]string{}
+	register := func(p *Pattern) {
+		names[p.Tracks[0].Pitch] = p.Name
+		if err := Register(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := marker("test-a", 1)
+	a.Fill, a.FillEvery, a.Next, a.Bars = "test-fill", 2, "test-b", 3
+	b := marker("test-b", 2)
+	b.Next, b.Bars = "test-a", 1
+	r := marker("test-repeat", 3)
+	r.Fill, r.FillEvery = "test-fill", 3
+	nf := marker("test-no-fill", 4)
+	nf.Fill, nf.FillEvery = "test-missing", 2
+	nn := marker("test-no-next", 5)
+	nn.Next, nn.Bars = "test-missing", 1
+	for _, p := range []*Pattern{a, b, r, nf, nn, marker("test-fill", 6)} {
+		register(p)
+	}
+
+	tests := []struct {
+		start string
+		bars  []string
+		err   string // err is the error of the bar after bars
+	}{
+		{"test-a", []string{"test-a", "test-fill", "test-a", "test-b", "test-a", "test-fill", "test-a", "test-b"}, ""},
+		{"test-b", []string{"test-b", "test-a", "test-fill", "test-a", "test-b"}, ""},
+		{"test-repeat", []string{"test-repeat", "test-repeat", "test-fill", "test-repeat", "test-repeat", "test-fill"}, ""},
+		{"test-no-fill", []string{"test-no-fill"}, `fill of test-no-fill: unknown drum pattern "test-missing"`},
+		{"test-no-next", []string{"test-no-next"}, `unknown drum pattern "test-missing"`},
+	}
+	for _, tt := range tests {
+		s, err := NewSequencer(tt.start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var bars []string
+		for i := range tt.bars {
+			es, err := s.Bar(int64(i)*1600, 1600)
+			if err != nil {
+				t.Errorf("%s: bar %d: %v", tt.start, i, err)
+				break
+			}
+			if len(es) != 1 || es[0].Time != int64(i)*1600 {
+				t.Fatalf("%s: bar %d has events %+v", tt.start, i, es)
+			}
+			bars = append(bars, names[es[0].Pitch])
+		}
+		if !reflect.DeepEqual(bars, tt.bars) {
+			t.Errorf("bars from %s are %v, want %v", tt.start, bars, tt.bars)
+		}
+		if tt.err != "" {
+			if _, err := s.Bar(0, 1600); err == nil || err.Error() != tt.err {
+				t.Errorf("%s: error %v, want %s", tt.start, err, tt.err)
+			}
+		}
+	}
+
+	if _, err := NewSequencer("test-missing"); err == nil {
+		t.Error("a sequencer starts with a missing pattern")
+	}
+}
+
+func TestBar(t *testing.T) {
+	p := &Pattern{
+		Name:  "test-bar",
+		Steps: 16,
+		Tracks: []Track{
+			{Voice: 1, Pitch: 35, Velocity: grid("9.......9.......")},
+			{Voice: 2, Pitch: 56, Velocity: grid("....9.......9..."), Probability: grid("....9.......9...")},
+			{Voice: 3, Pitch: 52, Velocity: grid("9999999999999999"), Probability: grid("................")},
+		},
+	}
+	if err := Register(p); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSequencer(p.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	es, err := s.Bar(100, 1600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []aujo.Event{
+		{Time: 100, Voice: 1, Type: aujo.EventOn, Pitch: 35, Velocity: 1},
+		{Time: 500, Voice: 2, Type: aujo.EventOn, Pitch: 56, Velocity: 1},
+		{Time: 900, Voice: 1, Type: aujo.EventOn, Pitch: 35, Velocity: 1},
+		{Time: 1300, Voice: 2, Type: aujo.EventOn, Pitch: 56, Velocity: 1},
+	}
+	if !reflect.DeepEqual(es, want) {
+		t.Errorf("Bar(100, 1600) =\n%+v\nwant\n%+v", es, want)
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	for _, p := range builtins {
+		for _, name := range []string{p.Fill, p.Next} {
+			if _, err := Named(name); name != "" && err != nil {
+				t.Errorf("pattern %s: %v", p.Name, err)
+			}
+		}
+	}
+}
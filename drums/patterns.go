@@ -0,0 +1,83 @@
+package drums
+
+// Voices and pitches of the drums of the built in patterns.
+const (
+	KickVoice  = 2
+	SnareVoice = 5
+	HatVoice   = 6
+
+	KickPitch  = 35
+	SnarePitch = 52
+	HatPitch   = 56
+)
+
+// grid returns the values of a row of steps written as digits, from . for
+// zero to 9 for one.
+func grid(row string) []float64 {
+	vs := make([]float64, len(row))
+	for i, c := range row {
+		if c >= '1' && c <= '9' {
+			vs[i] = float64(c-'0') / 9
+		}
+	}
+	return vs
+}
+
+var builtins = []*Pattern{
+	{
+		Name:  "groove",
+		Steps: 16,
+		Tracks: []Track{
+			{Voice: KickVoice, Pitch: KickPitch, Velocity: grid("9.....7...9.....")},
+			{Voice: SnareVoice, Pitch: SnarePitch, Velocity: grid("....9.......9..3"),
+				Probability: grid("....9.......9..4")},
+			{Voice: HatVoice, Pitch: HatPitch, Velocity: grid("7.5.7.5.7.5.7.5."),
+				Probability: grid("9.7.9.7.9.7.9.7.")},
+		},
+		Fill:      "fill",
+		FillEvery: 4,
+		Next:      "halftime",
+		Bars:      8,
+	},
+	{
+		Name:  "halftime",
+		Steps: 32,
+		Tracks: []Track{
+			{Voice: KickVoice, Pitch: KickPitch, Velocity: grid("9...........6...........7.......")},
+			{Voice: SnareVoice, Pitch: SnarePitch, Velocity: grid("................9...............")},
+			{Voice: HatVoice, Pitch: HatPitch, Velocity: grid("6.3.5.3.6.3.5.3.6.3.5.3.6.3.5.3."),
+				Probability: grid("9.4.9.4.9.4.9.4.9.4.9.4.9.4.9.4.")},
+		},
+		Fill:      "fill",
+		FillEvery: 4,
+		Next:      "groove",
+		Bars:      4,
+	},
+	{
+		Name:  "four",
+		Steps: 16,
+		Tracks: []Track{
+			{Voice: KickVoice, Pitch: KickPitch, Velocity: grid("9...9...9...9...")},
+			{Voice: HatVoice, Pitch: HatPitch, Velocity: grid("..7...7...7...7.")},
+		},
+		Fill:      "fill",
+		FillEvery: 8,
+	},
+	{
+		Name:  "fill",
+		Steps: 16,
+		Tracks: []Track{
+			{Voice: KickVoice, Pitch: KickPitch, Velocity: grid("9.......7.....9.")},
+			{Voice: SnareVoice, Pitch: SnarePitch, Velocity: grid("....9..5.5679999"),
+				Probability: grid("....9..6.6999999")},
+		},
+	},
+}
+
+func init() {
+	for _, p := range builtins {
+		if err := Register(p); err != nil {
+			panic(err)
+		}
+	}
+}
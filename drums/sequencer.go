@@ -0,0 +1,89 @@
+package drums
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/rwelin/aujo"
+	"github.com/rwelin/aujo/harmony"
+)
+
+// Sequencer plays registered patterns bar by bar, following their fills
+// and chains.
+type Sequencer struct {
+	pattern string
+	bar     int // bar is the number of bars played of the pattern
+}
+
+// NewSequencer returns a sequencer that starts with a pattern.
+func NewSequencer(pattern string) (*Sequencer, error) {
+	if _, err := Named(pattern); err != nil {
+		return nil, err
+	}
+	return &Sequencer{pattern: pattern}, nil
+}
+
+// next returns the pattern of the next bar, and moves on to the bar after.
+func (s *Sequencer) next() (*Pattern, error) {
+	p, err := Named(s.pattern)
+	if err != nil {
+		return nil, err
+	}
+	s.bar++
+
+	play := p
+	if p.Fill != "" && p.FillEvery > 0 && s.bar%p.FillEvery == 0 {
+		if play, err = Named(p.Fill); err != nil {
+			return nil, fmt.Errorf("fill of %s: %v", p.Name, err)
+		}
+	}
+	if p.Next != "" && s.bar >= p.Bars {
+		s.pattern = p.Next
+		s.bar = 0
+	}
+	return play, nil
+}
+
+// Bar returns the events of the next bar.
+func (s *Sequencer) Bar(start int64, duration int64) ([]aujo.Event, error) {
+	p, err := s.next()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []aujo.Event
+	step := duration / int64(p.Steps)
+	for i := 0; i < p.Steps; i++ {
+		for _, t := range p.Tracks {
+			if t.Velocity[i] == 0 {
+				continue
+			}
+			if len(t.Probability) > 0 && rand.Float64() >= t.Probability[i] {
+				continue
+			}
+			// drums are one-shots that are not released
+			events = append(events, aujo.Event{
+				Time:     start + int64(i)*step,
+				Voice:    t.Voice,
+				Type:     aujo.EventOn,
+				Pitch:    t.Pitch,
+				Velocity: t.Velocity[i],
+			})
+		}
+	}
+	return events, nil
+}
+
+// Progression returns the events of a bar for each chord of a
+// progression.
+func (s *Sequencer) Progression(p harmony.Progression) ([]aujo.Event, error) {
+	var events []aujo.Event
+	for _, step := range p.Steps {
+		es, err := s.Bar(step.Time, step.Duration)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, es...)
+	}
+	return events, nil
+}
@@ -0,0 +1,103 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rwelin/aujo/dsp"
+)
+
+// Spectrum returns the magnitudes of the frequencies 0 to n/2 of x,
+// windowed with dsp.Hann. The length of x must be a power of two. The
+// magnitudes are scaled so that a sine of amplitude A that is centered on
+// a bin peaks at A.
+func Spectrum(x []float64) ([]float64, error) {
+	n := len(x)
+	if n == 0 || n&(n-1) != 0 {
+		return nil, fmt.Errorf("length %d is not a power of two", n)
+	}
+
+	hann := dsp.Hann(n)
+	re := make([]float64, n)
+	im := make([]float64, n)
+	for i := range x {
+		re[i] = hann[i] * x[i]
+	}
+
+	dsp.FFT(re, im)
+
+	mag := make([]float64, n/2+1)
+	for i := range mag {
+		mag[i] = 4 * math.Hypot(re[i], im[i])
+	}
+	return mag, nil
+}
+
+// Spectrogram is a short time Fourier transform of a signal.
+type Spectrogram struct {
+	SampleRate float64
+	Size       int         // Size is the length of the transform of each frame
+	Hop        int         // Hop is the number of samples between frames
+	Frames     [][]float64 // Frames are the spectra of consecutive frames
+}
+
+// STFT computes the spectrogram of x sampled at sampleRate. Size must be a
+// power of two. Only whole frames are transformed, unless x is shorter
+// than a frame, in which case it is padded with zeros.
+func STFT(x []float64, sampleRate float64, size int, hop int) (*Spectrogram, error) {
+	if size <= 0 || size&(size-1) != 0 {
+		return nil, fmt.Errorf("size %d is not a power of two", size)
+	}
+	if hop <= 0 {
+		return nil, fmt.Errorf("hop %d is not positive", hop)
+	}
+
+	s := &Spectrogram{
+		SampleRate: sampleRate,
+		Size:       size,
+		Hop:        hop,
+	}
+	frame := make([]float64, size)
+	for start := 0; start == 0 || start+size <= len(x); start += hop {
+		n := copy(frame, x[start:])
+		for i := n; i < size; i++ {
+			frame[i] = 0
+		}
+		mag, err := Spectrum(frame)
+		if err != nil {
+			return nil, err
+		}
+		s.Frames = append(s.Frames, mag)
+	}
+	return s, nil
+}
+
+// Frequency returns the center frequency of bin.
+func (s *Spectrogram) Frequency(bin int) float64 {
+	return float64(bin) * s.SampleRate / float64(s.Size)
+}
+
+// Time returns the start time of frame in seconds.
+func (s *Spectrogram) Time(frame int) float64 {
+	return float64(frame*s.Hop) / s.SampleRate
+}
+
+// Average returns the mean magnitude of each bin over all frames.
+func (s *Spectrogram) Average() []float64 {
+	avg := make([]float64, s.Size/2+1)
+	for _, f := range s.Frames {
+		for i, v := range f {
+			avg[i] += v / float64(len(s.Frames))
+		}
+	}
+	return avg
+}
+
+// Decibels converts a magnitude to dB relative to full scale, with a floor
+// at -200 dB.
+func Decibels(mag float64) float64 {
+	if mag < 1e-10 {
+		return -200
+	}
+	return 20 * math.Log10(mag)
+}
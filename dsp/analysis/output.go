@@ -0,0 +1,76 @@
+package analysis
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+)
+
+// WriteSpectrumCSV writes one line per bin with the frequency, magnitude
+// and level in dB.
+func WriteSpectrumCSV(w io.Writer, spectrum []float64, sampleRate float64) error {
+	bw := bufio.NewWriter(w)
+	size := 2 * (len(spectrum) - 1)
+	fmt.Fprintln(bw, "frequency,magnitude,db")
+	for i, v := range spectrum {
+		f := float64(i) * sampleRate / float64(size)
+		fmt.Fprintf(bw, "%g,%g,%.2f\n", f, v, Decibels(v))
+	}
+	return bw.Flush()
+}
+
+// WriteCSV writes one line per frame with the start time of the frame and
+// the level in dB of each bin. The header has the frequencies of the bins.
+func (s *Spectrogram) WriteCSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "time")
+	for i := 0; i <= s.Size/2; i++ {
+		fmt.Fprintf(bw, ",%g", s.Frequency(i))
+	}
+	fmt.Fprintln(bw)
+	for j, f := range s.Frames {
+		fmt.Fprintf(bw, "%g", s.Time(j))
+		for _, v := range f {
+			fmt.Fprintf(bw, ",%.2f", Decibels(v))
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+// Image draws the spectrogram with time from left to right and frequency
+// from bottom to top, coloring levels from floor dB to 0 dB.
+func (s *Spectrogram) Image(floor float64) image.Image {
+	bins := s.Size/2 + 1
+	img := image.NewRGBA(image.Rect(0, 0, len(s.Frames), bins))
+	for x, f := range s.Frames {
+		for i, v := range f {
+			t := 1 - Decibels(v)/floor
+			img.Set(x, bins-1-i, heat(t))
+		}
+	}
+	return img
+}
+
+// WritePNG writes the image of the spectrogram as a PNG.
+func (s *Spectrogram) WritePNG(w io.Writer, floor float64) error {
+	return png.Encode(w, s.Image(floor))
+}
+
+// heat maps t in [0, 1] from black through red and yellow to white.
+func heat(t float64) color.RGBA {
+	t = math.Max(0, math.Min(1, t))
+	ch := func(v float64) uint8 {
+		return uint8(255 * math.Max(0, math.Min(1, v)))
+	}
+	return color.RGBA{
+		R: ch(3 * t),
+		G: ch(3*t - 1),
+		B: ch(3*t - 2),
+		A: 255,
+	}
+}
@@ -0,0 +1,33 @@
+package dsp
+
+// PolyBLEP returns the polynomial correction for a unit step at phase 0 of
+// an oscillator with phase t in [0, 1) and phase increment dt.
+func PolyBLEP(t, dt float64) float64 {
+	if t < dt {
+		t /= dt
+		return t + t - t*t - 1
+	} else if t > 1-dt {
+		t = (t - 1) / dt
+		return t*t + t + t + 1
+	}
+	return 0
+}
+
+// Saw returns a band limited sawtooth in [-1, 1] at phase t in [0, 1).
+func Saw(t, dt float64) float64 {
+	return 2*t - 1 - PolyBLEP(t, dt)
+}
+
+// Pulse returns a band limited pulse wave in [-1, 1] at phase t in [0, 1)
+// that is high for the fraction width of the period.
+func Pulse(t, dt, width float64) float64 {
+	v := -1.0
+	if t < width {
+		v = 1
+	}
+	t2 := t - width
+	if t2 < 0 {
+		t2 += 1
+	}
+	return v + PolyBLEP(t, dt) - PolyBLEP(t2, dt)
+}
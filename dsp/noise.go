@@ -0,0 +1,79 @@
+package dsp
+
+// NoiseSource generates noise in about [-1, 1].
+type NoiseSource interface {
+	Next() float64
+}
+
+// NewNoise returns a source of "white", "pink" or "brown" noise starting
+// from a seed, or nil for other colors. Sources with different seeds are
+// uncorrelated.
+func NewNoise(color string, seed uint64) NoiseSource {
+	white := WhiteNoise{state: scramble(seed)}
+	switch color {
+	case "white", "":
+		return &white
+	case "pink":
+		return &PinkNoise{white: white}
+	case "brown":
+		return &BrownNoise{white: white}
+	}
+	return nil
+}
+
+// scramble spreads the bits of a seed with the finalizer of splitmix64,
+// so that close seeds start far apart.
+func scramble(seed uint64) uint64 {
+	seed += 0x9E3779B97F4A7C15
+	seed = (seed ^ seed>>30) * 0xBF58476D1CE4E5B9
+	seed = (seed ^ seed>>27) * 0x94D049BB133111EB
+	return seed ^ seed>>31
+}
+
+// WhiteNoise has equal power at all frequencies. It uses a xorshift
+// generator so that it is cheap enough to run per sample.
+type WhiteNoise struct {
+	state uint64
+}
+
+func (n *WhiteNoise) Next() float64 {
+	if n.state == 0 {
+		n.state = 0x9E3779B97F4A7C15
+	}
+	n.state ^= n.state << 13
+	n.state ^= n.state >> 7
+	n.state ^= n.state << 17
+	return float64(n.state>>11)/(1<<52) - 1
+}
+
+// PinkNoise falls 3 dB per octave, using the filter of Paul Kellet.
+type PinkNoise struct {
+	white WhiteNoise
+	b     [7]float64
+}
+
+func (n *PinkNoise) Next() float64 {
+	w := n.white.Next()
+	b := &n.b
+	b[0] = 0.99886*b[0] + w*0.0555179
+	b[1] = 0.99332*b[1] + w*0.0750759
+	b[2] = 0.96900*b[2] + w*0.1538520
+	b[3] = 0.86650*b[3] + w*0.3104856
+	b[4] = 0.55000*b[4] + w*0.5329522
+	b[5] = -0.7616*b[5] - w*0.0168980
+	p := b[0] + b[1] + b[2] + b[3] + b[4] + b[5] + b[6] + w*0.5362
+	b[6] = w * 0.115926
+	return p * 0.15
+}
+
+// BrownNoise falls 6 dB per octave. It is integrated white noise with a
+// leak that keeps it from drifting.
+type BrownNoise struct {
+	white WhiteNoise
+	last  float64
+}
+
+func (n *BrownNoise) Next() float64 {
+	n.last = 0.998*n.last + 0.03*n.white.Next()
+	return n.last
+}
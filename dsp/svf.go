@@ -0,0 +1,46 @@
+package dsp
+
+import "math"
+
+// SVF is a state variable filter using the trapezoidal integration of
+// Zavalishin, which stays stable while the cutoff is modulated.
+type SVF struct {
+	ic1eq float64
+	ic2eq float64
+}
+
+// Process filters one sample. The cutoff is a fraction of the sampling
+// frequency and the resonance is in [0, 1), where values close to 1 make
+// the filter self-oscillate.
+func (f *SVF) Process(x, cutoff, resonance float64) (low, band, high float64) {
+	if cutoff > 0.49 {
+		cutoff = 0.49
+	} else if cutoff < 1e-5 {
+		cutoff = 1e-5
+	}
+	if resonance > 0.995 {
+		resonance = 0.995
+	} else if resonance < 0 {
+		resonance = 0
+	}
+
+	g := math.Tan(math.Pi * cutoff)
+	k := 2 - 2*resonance
+	a1 := 1 / (1 + g*(g+k))
+	a2 := g * a1
+	a3 := g * a2
+
+	v3 := x - f.ic2eq
+	v1 := a1*f.ic1eq + a2*v3
+	v2 := f.ic2eq + a2*f.ic1eq + a3*v3
+	f.ic1eq = 2*v1 - f.ic1eq
+	f.ic2eq = 2*v2 - f.ic2eq
+
+	return v2, v1, x - k*v1 - v2
+}
+
+// Reset clears the state of the filter.
+func (f *SVF) Reset() {
+	f.ic1eq = 0
+	f.ic2eq = 0
+}
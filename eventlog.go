@@ -0,0 +1,66 @@
+package aujo
+
+import (
+	"encoding/json"
+	"io"
+)
+
+func isLogType(typ string) bool {
+	return hasType(LogTypes, typ)
+}
+
+func hasType(types []string, typ string) bool {
+	for _, t := range types {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
+
+// EventLog writes the messages of a mix about the music it plays to a
+// writer as JSON lines.
+type EventLog struct {
+	cancel func()
+	done   chan struct{}
+	err    error
+}
+
+// NewEventLog starts writing the messages of the types, or else of
+// LogTypes, to w until Close. Messages are dropped while w is slow, and
+// writing stops at the first error.
+func (m *Mix) NewEventLog(w io.Writer, types ...string) *EventLog {
+	if len(types) == 0 {
+		types = LogTypes
+	}
+	msgs, cancel := m.Subscribe(256)
+	l := &EventLog{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(l.done)
+		enc := json.NewEncoder(w)
+		for msg := range msgs {
+			if !hasType(types, msg.Type) || l.err != nil {
+				continue
+			}
+			if l.err = enc.Encode(msg); l.err != nil {
+				cancel()
+			}
+		}
+	}()
+	return l
+}
+
+// Done returns a channel that is closed when the log stops.
+func (l *EventLog) Done() <-chan struct{} {
+	return l.done
+}
+
+// Close stops the log and returns the error that stopped it, if any.
+func (l *EventLog) Close() error {
+	l.cancel()
+	<-l.done
+	return l.err
+}
@@ -2,503 +2,219 @@ package examples
 
 import (
 	"fmt"
-	"math"
-	"math/rand"
-	"os"
 	"sort"
+	"sync"
 
 	"github.com/rwelin/aujo"
+	"github.com/rwelin/aujo/drums"
+	"github.com/rwelin/aujo/harmony"
 )
 
-type intervals []float64
+// ChordVoice is the voice that plays the chords of AutoChords with its
+// pattern. Other voices play the chords too when they have a pattern.
+const ChordVoice = 3
 
-func (i intervals) Equal(j intervals) bool {
-	for k := range i {
-		if i[k] != j[k] {
-			return false
-		}
-	}
-	return true
-}
-
-func (i intervals) Add(g float64) intervals {
-	var ret intervals
-	for _, f := range i {
-		ret = append(ret, f+g)
-	}
-	return ret
-}
-
-func (i intervals) Expand() intervals {
-	var exp []float64
-	for _, f := range i {
-		exp = append(exp, f, f-12, f+12, f-24)
-	}
-	sort.Float64s(exp)
-	return intervals(exp)
-}
-
-var (
-	s_Major = intervals{0, 2, 4, 5, 7, 9, 11}
-	s_Minor = intervals{0, 2, 3, 5, 7, 8, 10, 11}
-)
-
-var (
-	c_I          = intervals{0, 4, 7}
-	c_iii7       = intervals{2, 4, 7, 11}
-	c_vi7        = intervals{-3, 0, 4, 7}
-	c_I6         = intervals{0, 4, 7, 9}
-	c_ii7        = intervals{0, 2, 5, 9}
-	c_IV7        = intervals{0, 4, 5, 9}
-	c_V7         = intervals{2, 5, 7, 11}
-	c_vii_dim_7  = intervals{-1, 2, 5, 9}
-	c_ii7b5      = intervals{0, 2, 5, 8}
-	c_bIII_aug_7 = intervals{2, 3, 7, 11}
-	c_V7sus4     = intervals{2, 5, 7, 12}
-
-	c_i        = intervals{0, 3, 7}
-	c_ii_dim_7 = intervals{0, 2, 5, 8}
-	c_III_7    = intervals{2, 3, 7, 10}
-	c_iv7      = intervals{0, 3, 5, 8}
-	c_VI7      = intervals{0, 3, 7, 8}
-	c_vii_7    = intervals{2, 5, 8, 10}
-)
+// BassVoice is the voice that plays the bass line of AutoChords.
+const BassVoice = 7
 
-var tonicChords = []intervals{
-	c_I,
+// chordPattern is the pattern of a voice that plays chords.
+type chordPattern struct {
+	voice   int
+	pattern aujo.Pattern
 }
 
-var subDominantChords = []intervals{
-	c_ii7,
-	c_IV7,
-}
-
-var dominantChords = []intervals{
-	c_V7,
-	c_vii_dim_7,
-}
-
-var otherChords = []intervals{
-	c_iii7,
-	c_vi7,
-}
-
-var minorTonicChords = []intervals{
-	c_i,
-}
-
-var minorSubDominantChords = []intervals{
-	c_ii_dim_7,
-	c_iv7,
-}
-
-var minorDominantChords = []intervals{
-	c_V7,
-	c_vii_dim_7,
-}
-
-var minorOtherChords = []intervals{
-	c_III_7,
-	c_VI7,
-	c_vii_7,
-}
-
-const (
-	funcTonic = iota
-	funcSubDom
-	funcDom
-	funcOther
-
-	funcMax
-)
-
-var functionMap = map[int][]intervals{
-	funcTonic:  tonicChords,
-	funcSubDom: subDominantChords,
-	funcDom:    dominantChords,
-	funcOther:  otherChords,
-}
-
-var minorFunctionMap = map[int][]intervals{
-	funcTonic:  minorTonicChords,
-	funcSubDom: minorSubDominantChords,
-	funcDom:    minorDominantChords,
-	funcOther:  minorOtherChords,
-}
-
-func substituteChords(minor bool, function int) []intervals {
-	if minor {
-		return nil
-	} else {
-		switch function {
-		case funcTonic:
-			return []intervals{
-				c_vi7,
-				c_I6,
-			}
-		case funcDom:
-			return []intervals{
-				c_ii7b5,
-				c_bIII_aug_7,
-				c_V7sus4,
-			}
-
-		}
-	}
-	return nil
-}
-
-func middleFunctions(prevFunction int, nextFunction int) []int {
-	pot := make(map[int]struct{})
-	fromPrev := followingFunctions(prevFunction)
-	for _, f := range fromPrev {
-		p := followingFunctions(f)
-		for _, g := range p {
-			if g == nextFunction {
-				pot[f] = struct{}{}
-				break
-			}
+// chordPatterns returns the patterns of the voices that play the chords:
+// ChordVoice, and the other voices that have a pattern.
+func chordPatterns(voices []aujo.Voice) []chordPattern {
+	ps := []chordPattern{{voice: ChordVoice}}
+	for i, v := range voices {
+		if i == ChordVoice {
+			ps[0].pattern = v.Pattern
+		} else if v.Pattern != (aujo.Pattern{}) {
+			ps = append(ps, chordPattern{i, v.Pattern})
 		}
 	}
-
-	var funcs []int
-	for f := range pot {
-		funcs = append(funcs, f)
-	}
-	return funcs
+	return ps
 }
 
-func followingFunctions(currentFunction int) []int {
-	var funcs []int
-	switch currentFunction {
-	case funcTonic:
-		funcs = []int{funcSubDom, funcDom, funcOther}
-	case funcSubDom:
-		funcs = []int{funcTonic, funcDom, funcOther}
-	case funcDom:
-		funcs = []int{funcTonic}
-	case funcOther:
-		funcs = []int{funcTonic, funcSubDom, funcDom}
-	default:
-		panic("no")
-	}
-	return funcs
-}
-
-func nextFunction(currentFunction int) int {
-	funcs := followingFunctions(currentFunction)
-	return funcs[rand.Intn(len(funcs))]
-}
-
-type nextChordResult struct {
-	Function            int
-	MinDistChord        intervals
-	CanModulateUp       bool
-	CanModulateDown     bool
-	CanModulateRelative bool
-}
-
-func (a *autoChord) nextChord(prevFunction int, prevChord intervals, exclude []intervals) nextChordResult {
-
-	scale := s_Major.Add(a.TonicPitch).Expand()
-	if a.Minor {
-		scale = s_Minor.Add(a.TonicPitch).Expand()
-	}
-	var chromaticNote float64
-	var requiredNotes []float64
-	for i := range prevChord {
-		found := false
-		for j := range scale {
-			if prevChord[i] == scale[j] {
-				found = true
-				break
-			} else if prevChord[i] < scale[j] {
-				break
-			}
-		}
-		if !found {
-			chromaticNote = prevChord[i]
-			break
-		}
-	}
-
-	if chromaticNote != 0 {
-		r := float64(0)
-		for i := len(scale) - 1; i >= 0; i-- {
-			if r == 0 ||
-				math.Abs(scale[i]-chromaticNote) < math.Abs(r-chromaticNote) {
-				r = scale[i]
-			}
-		}
-		requiredNotes = append(requiredNotes, r)
-	}
-
-	for attempts := 0; ; attempts++ {
-		function := nextFunction(prevFunction)
-		chords := functionMap[function]
-		if a.Minor {
-			chords = minorFunctionMap[function]
-		}
-		if a.Modulate != modulationChance {
-			chords = append(chords, substituteChords(a.Minor, function)...)
-		}
-		c := chords[rand.Intn(len(chords))]
-		minDistChord := findMinDistChord(prevChord, c.Add(a.TonicPitch), requiredNotes)
-
-		inExclude := false
-		for _, e := range exclude {
-			eq := true
-			for i := range minDistChord {
-				if e[i] != minDistChord[i] {
-					eq = false
-					break
-				}
-			}
-			if eq {
-				inExclude = true
-				break
-			}
-		}
-
-		foundRequiredNote := len(requiredNotes)
-		if foundRequiredNote > 0 {
-			for _, r := range requiredNotes {
-				for _, n := range minDistChord {
-					if n == r {
-						foundRequiredNote--
-						break
-					}
-				}
-			}
-		}
-
-		if (foundRequiredNote == 0 && !inExclude) ||
-			(attempts > 50 && (foundRequiredNote == 0 || !inExclude)) ||
-			attempts > 100 {
-			return nextChordResult{
-				Function:     function,
-				MinDistChord: minDistChord,
-				//CanModulateUp:   c.Equal(c_vi7),
-				//CanModulateDown: c.Equal(c_ii7),
-				//CanModulateUp: c.Equal(c_vi7) || c.Equal(c_I7) || c.Equal(c_iii7),
-				CanModulateDown:     c.Equal(c_ii7) || c.Equal(c_IV7) || c.Equal(c_vi7),
-				CanModulateRelative: a.Minor && c.Equal(c_vii_7) || !a.Minor && c.Equal(c_V7),
-			}
-		}
+func samePatterns(a []chordPattern, b []chordPattern) bool {
+	if len(a) != len(b) {
+		return false
 	}
-}
-
-func events(chord []float64, offset int64) []aujo.Event {
-	var events []aujo.Event
-	for i, f := range chord {
-		e := aujo.Event{
-			Time:  offset + 2000*int64(i),
-			Voice: 3,
-			Type:  aujo.EventOn,
-			Pitch: f,
+	for i := range a {
+		if a[i] != b[i] {
+			return false
 		}
-
-		events = append(events, e)
 	}
-	return events
+	return true
 }
 
-func findMinDistChord(prevChord intervals, nextChord intervals, requiredNotes []float64) intervals {
-	exp := nextChord.Expand()
+// progressionEvents plays each chord of a progression with the patterns of
+// the voices, and publishes the chords and changes of key as they start.
+func progressionEvents(p harmony.Progression, patterns []chordPattern) []aujo.Event {
+	var es []aujo.Event
 
-	const numChordNotes = 4
-
-	minDist := float64(0)
-	var minDistChord []float64
-	for i := 0; i <= len(exp)-numChordNotes; i++ {
-		c1 := exp[i : i+numChordNotes]
-		var dist float64
-		for j := 0; j < len(c1); j++ {
-			d := 10 + math.Pow(prevChord[j]-c1[j], 2) + math.Pow((c1[j]-57)/5, 2)
-			dist += math.Sqrt(d)
-		}
-		for j := 0; j < len(requiredNotes); j++ {
-			found := false
-			for k := 0; k < len(c1); k++ {
-				if c1[k] == requiredNotes[j] {
-					found = true
-				}
+	key := p.Key
+	for _, s := range p.Steps {
+		if s.Modulation != harmony.NoModulation {
+			msg := aujo.ModulationMessage{
+				Modulation: string(s.Modulation),
+				From:       key.String(),
+				To:         s.Key.String(),
 			}
-			if !found {
-				dist += 100
+			es = append(es, aujo.Event{Time: s.Time, Func: func(m *aujo.Mix) {
+				m.PublishEvent(aujo.MessageModulation, msg)
+			}})
+		}
+		key = s.Key
+
+		msg := aujo.ChordMessage{
+			Key:      s.Key.String(),
+			Chord:    s.Chord.Name,
+			Symbol:   s.Chord.Symbol(s.Key),
+			Function: s.Function.String(),
+			Notes:    s.Key.NoteNames(s.Notes),
+			Pitches:  s.Notes,
+		}
+		es = append(es, aujo.Event{Time: s.Time, Func: func(m *aujo.Mix) {
+			m.PublishEvent(aujo.MessageChord, msg)
+		}})
+		for _, c := range patterns {
+			es = append(es, c.pattern.Events(c.voice, s.Notes, s.Time, s.Duration)...)
+		}
+	}
+
+	return es
+}
+
+// noteEvents plays notes on a voice, releasing each before the next.
+func noteEvents(notes []harmony.Note, voice int) []aujo.Event {
+	var es []aujo.Event
+	for _, n := range notes {
+		es = append(es, aujo.Event{
+			Time:     n.Time,
+			Voice:    voice,
+			Type:     aujo.EventOn,
+			Pitch:    n.Pitch,
+			Velocity: n.Velocity,
+		}, aujo.Event{
+			Time:  n.Time + n.Duration*9/10,
+			Voice: voice,
+			Type:  aujo.EventOff,
+			Pitch: n.Pitch,
+		})
+	}
+	return es
+}
+
+// autoChords plays endless progressions.
+type autoChords struct {
+	g           *harmony.Generator
+	mg          *harmony.MelodyGenerator
+	bass        *harmony.BassGenerator
+	melodyVoice int
+	drums       *drums.Sequencer
+	mu          sync.Mutex // mu keeps sequences from being generated at once
+	errs        []error    // errs are logged when the next sequence starts
+}
+
+// sequence returns a sequence that plays the next progression with the
+// chord patterns and then continues with another sequence. The following
+// sequence is generated once, while this one plays, so that the mix only
+// swaps it in.
+func (a *autoChords) sequence(patterns []chordPattern) *aujo.Sequence {
+	p := a.g.Next(2, 4)
+	var melody []harmony.Note
+	if a.melodyVoice >= 0 {
+		melody = a.mg.Melody(p)
+	}
+	bass := a.bass.Line(p)
+	var beat []aujo.Event
+	if a.drums != nil {
+		var err error
+		if beat, err = a.drums.Progression(p); err != nil {
+			a.errs = append(a.errs, fmt.Errorf("drums: %v", err))
+		}
+	}
+	last := p.Steps[len(p.Steps)-1]
+	errs := a.errs
+	a.errs = nil
+
+	events := func(patterns []chordPattern) []aujo.Event {
+		e := progressionEvents(p, patterns)
+		e = append(e, noteEvents(melody, a.melodyVoice)...)
+		e = append(e, noteEvents(bass, BassVoice)...)
+		e = append(e, beat...)
+		sort.SliceStable(e, func(i, j int) bool { return e[i].Time < e[j].Time })
+		return e
+	}
+
+	var once sync.Once
+	next := make(chan *aujo.Sequence, 1)
+	var following *aujo.Sequence
+	start := func(m *aujo.Mix, patterns []chordPattern) {
+		once.Do(func() {
+			for _, err := range errs {
+				m.Log(aujo.LogWarning, err)
 			}
-		}
-		if minDistChord == nil || dist < minDist {
-			minDist = dist
-			minDistChord = c1
-		}
-	}
-
-	return minDistChord
-}
-
-const chordDuration = 96000
-
-const microOffset = 0.5
-
-func (a *autoChord) progression(reps int, length int, prevBass float64, prevFunction int, prevChord intervals) (es []aujo.Event, lastBass float64, lastFunction int, lastChord intervals) {
-
-	var cc []nextChordResult
-
-	for i := 0; i < length; i++ {
-		excludeChords := a.LastProgression
-		for _, c := range cc {
-			excludeChords = append(excludeChords, c.MinDistChord)
-		}
-
-		res := a.nextChord(prevFunction, prevChord, excludeChords)
-
-		if i%2 == 1 {
-			res.MinDistChord = res.MinDistChord.Add(microOffset)
-		}
-
-		cc = append(cc, res)
-		prevChord = res.MinDistChord
-		prevFunction = res.Function
-	}
-
-	a.LastProgression = a.LastProgression[:0]
-	for _, c := range cc {
-		a.LastProgression = append(a.LastProgression, c.MinDistChord)
-	}
-
-	var prevPrevBass float64
-
-	fmt.Fprintln(os.Stderr, "TONIC", a.TonicPitch)
-	for i := 0; i < reps; i++ {
-		for j := 0; j < len(cc); j++ {
-			c := cc[j].MinDistChord
-			f := cc[j].Function
-			if i == reps-1 && j == len(cc)-1 {
-				penultimateChord := cc[j-1]
-				if (penultimateChord.CanModulateUp || penultimateChord.CanModulateDown) &&
-					rand.Intn(a.Modulate) == 0 {
-					if penultimateChord.CanModulateUp {
-						fmt.Fprintln(os.Stderr, "MODULATE UP")
-						a.TonicPitch += 7
-						if a.TonicPitch > 69 {
-							a.TonicPitch -= 12
-						}
-					} else if penultimateChord.CanModulateDown {
-						fmt.Fprintln(os.Stderr, "MODULATE DOWN")
-						a.TonicPitch -= 7
-						if a.TonicPitch < 69 {
-							a.TonicPitch += 12
-						}
-					}
-					c = findMinDistChord(penultimateChord.MinDistChord, c_V7.Add(a.TonicPitch), nil)
-					f = funcDom
-					prevChord = c
-					prevFunction = funcDom
-					a.Modulate = modulationChance
-				} else if cc[j].CanModulateRelative && rand.Intn(a.Modulate) == 0 {
-					if a.Minor {
-						fmt.Fprintln(os.Stderr, "MODULATE RELATIVE MAJOR")
-						a.Minor = false
-						a.TonicPitch += 3
-						if a.TonicPitch > 69 {
-							a.TonicPitch -= 12
-						}
-					} else {
-						fmt.Fprintln(os.Stderr, "MODULATE RELATIVE MINOR")
-
-						a.Minor = true
-						a.TonicPitch -= 3
-						if a.TonicPitch < 66 {
-							a.TonicPitch += 12
-						}
-					}
-					prevFunction = funcDom
-					a.Modulate = modulationChance
-				}
+			go func() {
+				a.mu.Lock()
+				defer a.mu.Unlock()
+				next <- a.sequence(patterns)
+			}()
+		})
+	}
+
+	s := &aujo.Sequence{}
+	end := aujo.Event{
+		Time: last.Time + last.Duration,
+		Func: func(m *aujo.Mix) {
+			// the sequence may have been entered after its start
+			start(m, chordPatterns(m.Voices))
+			if following == nil {
+				following = <-next
 			}
-
-			var bass, bass1 float64
-			for {
-				getBassNote := func(prev float64, prevPrev float64) float64 {
-					for {
-						n := c[rand.Intn(len(c))]
-						for n > 45 {
-							n -= 12
-						}
-						for n < 29 {
-							n += 12
-						}
-						if n != prev && n != prevPrev {
-							return n
-						}
-					}
-				}
-				bass = getBassNote(prevBass, prevPrevBass)
-
-				if bass-prevBass <= 3 && bass-prevBass > 0 {
-					bass1 = bass - 1
-				} else if prevBass-bass < 3 && prevBass-bass > 0 {
-					bass1 = bass + 1
-				} else {
-					bass1 = getBassNote(bass, prevBass)
-				}
-				prevBass, prevPrevBass = bass, prevBass
-				break
+			m.SetNextSequence(following)
+		},
+	}
+	s.Events = []aujo.Event{{
+		// follow the patterns of the voices when the sequence starts
+		Func: func(m *aujo.Mix) {
+			ps := chordPatterns(m.Voices)
+			if !samePatterns(ps, patterns) {
+				patterns = ps
+				s.Events = append(append(s.Events[:1], events(ps)...), end)
 			}
-
-			chordTime := int64(i*len(cc)+j) * chordDuration
-
-			if bass1 != 0 {
-				if i%2 == 0 {
-					bass1 -= microOffset
-				}
-
-				walkingBassTime := chordTime - chordDuration/2
-				es = append(es, events([]float64{bass1}, walkingBassTime)...)
-			}
-
-			fmt.Fprintln(os.Stderr, bass1, bass, c, f)
-			es = append(es, events(append([]float64{bass}, c...), chordTime)...)
-		}
-	}
-	fmt.Fprintln(os.Stderr)
-
-	if a.Modulate > 1 {
-		a.Modulate--
-	}
-
-	return es, prevBass, prevFunction, prevChord
+			start(m, ps)
+		},
+	}}
+	s.Events = append(append(s.Events, events(patterns)...), end)
+	return s
 }
 
-func (a *autoChord) seq(prevBass float64, prevFunction int, prevChord intervals) *aujo.Sequence {
+// MelodyVoice is the voice that plays the melody of AutoChords.
+const MelodyVoice = 0
 
-	e, prevBass, prevFunction, prevChord := a.progression(2, 4, prevBass, prevFunction, prevChord)
+// DrumPattern is the drum pattern that AutoChords starts with.
+const DrumPattern = "groove"
 
-	return &aujo.Sequence{
-		Events: append(e, aujo.Event{
-			Time: e[len(e)-1].Time + chordDuration,
-			Func: func(m *aujo.Mix) {
-				m.SetNextSequence(a.seq(prevBass, prevFunction, prevChord))
-			},
-		}),
-	}
-}
-
-type autoChord struct {
-	TonicPitch      float64
-	LastProgression []intervals
-	Modulate        int
-	Minor           bool
+func AutoChords() *aujo.Sequence {
+	return AutoChordsStyle(harmony.Classic, MelodyVoice)
 }
 
-const modulationChance = 2
-
-func AutoChords() *aujo.Sequence {
-	a := &autoChord{
-		TonicPitch: 69,
-		Modulate:   modulationChance,
-		Minor:      false,
+// AutoChordsStyle plays endless progressions in a style, with a melody on
+// a voice unless it is negative.
+func AutoChordsStyle(style *harmony.Style, melodyVoice int) *aujo.Sequence {
+	a := &autoChords{
+		g:           harmony.NewGenerator(harmony.Key{Tonic: 69}, style),
+		mg:          harmony.NewMelodyGenerator(),
+		bass:        harmony.NewBassGenerator(style.Bass),
+		melodyVoice: melodyVoice,
+	}
+	if d, err := drums.NewSequencer(DrumPattern); err != nil {
+		a.errs = append(a.errs, err)
+	} else {
+		a.drums = d
 	}
-	return a.seq(0, funcDom, c_V7.Add(a.TonicPitch-12))
+	return a.sequence(chordPatterns(nil))
 }
@@ -0,0 +1,19 @@
+package examples
+
+import (
+	"github.com/rwelin/aujo"
+	"github.com/rwelin/aujo/harmony"
+)
+
+// aMajor is the scale of A major from A4.
+var aMajor = harmony.Intervals(harmony.Major).Add(69)
+
+func init() {
+	aujo.RegisterSequence("autochords", AutoChords)
+	for _, s := range []*harmony.Style{harmony.Pop, harmony.Jazz, harmony.Modal} {
+		s := s
+		aujo.RegisterSequence("autochords-"+s.Name, func() *aujo.Sequence { return AutoChordsStyle(s, MelodyVoice) })
+	}
+	aujo.RegisterSequence("basic", func() *aujo.Sequence { return Basic(aMajor) })
+	aujo.RegisterSequence("chords", func() *aujo.Sequence { return Chords(aMajor) })
+}
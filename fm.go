@@ -0,0 +1,164 @@
+package aujo
+
+import (
+	"fmt"
+	"math"
+)
+
+// MinOperators and MaxOperators bound the number of operators of an FM
+// instrument.
+const (
+	MinOperators = 4
+	MaxOperators = 6
+)
+
+// Operator is a sine oscillator of an FM instrument. The output of a
+// carrier is scaled by Level, while the output of a modulator is added to
+// the phase of the operators it modulates with Level as the modulation
+// index in radians.
+type Operator struct {
+	Ratio    float64 // Ratio is the frequency as a multiple of the pitch
+	Detune   float64 // Detune is added to the frequency in Hz
+	Level    float64
+	Envelope ADSR // Envelope is optional, the level is constant without one
+}
+
+type fmAlgorithm struct {
+	modulators [MaxOperators][]int // modulators of each operator
+	carriers   []int
+	operators  int // operators is the fewest operators the algorithm can connect
+}
+
+// fmAlgorithms are the ways the operators can be connected. An operator
+// is only modulated by operators with a higher index, and the operator
+// with the highest index is the one that feeds back to itself. An
+// algorithm that takes fewer than MaxOperators ends its chains early when
+// operators are left out.
+var fmAlgorithms = []fmAlgorithm{
+	// 0 <- 1 <- 2 <- 3 <- 4 <- 5
+	{modulators: [MaxOperators][]int{{1}, {2}, {3}, {4}, {5}}, carriers: []int{0}, operators: 4},
+	// 0 <- 1 <- 2, 3 <- 4 <- 5
+	{modulators: [MaxOperators][]int{{1}, {2}, nil, {4}, {5}}, carriers: []int{0, 3}, operators: 5},
+	// 0 <- 1, 2 <- 3, 4 <- 5
+	{modulators: [MaxOperators][]int{{1}, nil, {3}, nil, {5}}, carriers: []int{0, 2, 4}, operators: 6},
+	// 0 <- (1 <- 2, 3 <- 4 <- 5)
+	{modulators: [MaxOperators][]int{{1, 3}, {2}, nil, {4}, {5}}, carriers: []int{0}, operators: 4},
+	// (0, 1, 2, 3, 4) <- 5
+	{modulators: [MaxOperators][]int{{5}, {5}, {5}, {5}, {5}}, carriers: []int{0, 1, 2, 3, 4}, operators: 6},
+	// 0, 1, 2, 3, 4, 5
+	{carriers: []int{0, 1, 2, 3, 4, 5}, operators: 4},
+}
+
+// FM is a phase modulation instrument with MinOperators to MaxOperators
+// operators connected by one of the algorithms. The attenuation scales the
+// modulation indices, so that high notes and late parts of notes become
+// less bright.
+type FM struct {
+	Operators []Operator
+	Algorithm int
+	Feedback  float64
+
+	ADSR
+
+	Attenuation Attenuation
+}
+
+type fmState struct {
+	eventTime int64
+	envStart  [MaxOperators]float64
+	env       [MaxOperators]float64
+	feedback  [2]float64
+}
+
+func (inst *FM) Type() string {
+	return "fm"
+}
+
+func (inst *FM) Validate() error {
+	if len(inst.Operators) < MinOperators || len(inst.Operators) > MaxOperators {
+		return fmt.Errorf("%d operators is not in [%d, %d]", len(inst.Operators), MinOperators, MaxOperators)
+	}
+	if inst.Algorithm < 0 || inst.Algorithm >= len(fmAlgorithms) {
+		return fmt.Errorf("algorithm %d is not in [0, %d)", inst.Algorithm, len(fmAlgorithms))
+	}
+	if n := fmAlgorithms[inst.Algorithm].operators; len(inst.Operators) < n {
+		return fmt.Errorf("algorithm %d needs %d operators", inst.Algorithm, n)
+	}
+	for i := range inst.Operators {
+		op := &inst.Operators[i]
+		if op.Ratio < 0 {
+			return fmt.Errorf("operator %d ratio %g is negative", i, op.Ratio)
+		}
+		if err := op.Envelope.Validate(); err != nil {
+			return fmt.Errorf("operator %d: %v", i, err)
+		}
+	}
+	if inst.Attenuation.P1 < 0 {
+		return fmt.Errorf("attenuation P1 %g is negative", inst.Attenuation.P1)
+	}
+	return inst.ADSR.Validate()
+}
+
+func (inst *FM) Mix(c *Channel, step float64, offset int64) float64 {
+	st, _ := c.state.(*fmState)
+	if st == nil {
+		st = &fmState{eventTime: c.EventTime}
+		c.state = st
+	}
+	if st.eventTime != c.EventTime {
+		st.eventTime = c.EventTime
+		st.envStart = st.env
+	}
+
+	if inst.Algorithm < 0 || inst.Algorithm >= len(fmAlgorithms) {
+		return 0
+	}
+	alg := &fmAlgorithms[inst.Algorithm]
+
+	n := len(inst.Operators)
+	if n > MaxOperators {
+		n = MaxOperators
+	}
+
+	atten := inst.Attenuation.factor(c.Pitch, offset)
+	f := pitchToFreq(c.Pitch)
+
+	var out [MaxOperators]float64
+	for i := n - 1; i >= 0; i-- {
+		op := &inst.Operators[i]
+
+		env := 1.0
+		if op.Envelope != (ADSR{}) {
+			var ok bool
+			env, ok = op.Envelope.Level(c.Event, offset, st.envStart[i])
+			if !ok {
+				env = 0
+			}
+		}
+		st.env[i] = env
+
+		var mod float64
+		for _, j := range alg.modulators[i] {
+			if j < n {
+				mod += out[j] * atten
+			}
+		}
+		if i == n-1 {
+			mod += inst.Feedback * (st.feedback[0] + st.feedback[1]) / 2
+		}
+
+		out[i] = env * op.Level * math.Sin(step*(f*op.Ratio+op.Detune)+mod)
+
+		if i == n-1 {
+			st.feedback[0], st.feedback[1] = st.feedback[1], out[i]
+		}
+	}
+
+	var sum float64
+	for _, i := range alg.carriers {
+		if i < n {
+			sum += out[i]
+		}
+	}
+	return sum
+}
@@ -0,0 +1,29 @@
+package aujo
+
+import "testing"
+
+func TestFMOperators(t *testing.T) {
+	tests := []struct {
+		algorithm int
+		operators int
+		valid     bool
+	}{
+		{0, 3, false},
+		{0, 4, true},
+		{1, 4, false},
+		{1, 5, true},
+		{2, 5, false},
+		{2, 6, true},
+		{3, 4, true},
+		{4, 5, false},
+		{4, 6, true},
+		{5, 4, true},
+		{5, 7, false},
+	}
+	for _, tt := range tests {
+		inst := FM{Algorithm: tt.algorithm, Operators: make([]Operator, tt.operators)}
+		if err := inst.Validate(); (err == nil) != tt.valid {
+			t.Errorf("algorithm %d with %d operators: %v", tt.algorithm, tt.operators, err)
+		}
+	}
+}
@@ -5,4 +5,5 @@ go 1.13
 require (
 	gioui.org v0.0.0-20191122135004-4072361fd57b
 	github.com/gorilla/mux v1.7.3
+	github.com/gorilla/websocket v1.4.2
 )
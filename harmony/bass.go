@@ -0,0 +1,197 @@
+package harmony
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// BassStyle is how a bass line moves through the chords.
+type BassStyle string
+
+const (
+	RootFifthBass  BassStyle = "root-fifth" // RootFifthBass plays the root and then the fifth of each chord
+	WalkingBass    BassStyle = "walking"    // WalkingBass walks in quarter notes to a chromatic approach of the next root
+	PedalBass      BassStyle = "pedal"      // PedalBass pulses on the tonic of the key in eighth notes
+	SyncopatedBass BassStyle = "syncopated" // SyncopatedBass plays the root, octave and fifth off the beat
+)
+
+// valid returns whether the style is known, or empty for RootFifthBass.
+func (s BassStyle) valid() bool {
+	switch s {
+	case "", RootFifthBass, WalkingBass, PedalBass, SyncopatedBass:
+		return true
+	}
+	return false
+}
+
+// beat is a note of a bass line in eighths of a chord.
+type beat struct {
+	at, length      int
+	pitch, velocity float64
+}
+
+// BassGenerator writes bass lines over progressions, continuing from the
+// previous line.
+type BassGenerator struct {
+	Style     BassStyle
+	Low, High float64 // Low and High are the range of the bass
+
+	prev float64
+}
+
+// NewBassGenerator returns a generator of bass lines below the chords of
+// a Generator.
+func NewBassGenerator(style BassStyle) *BassGenerator {
+	return &BassGenerator{
+		Style: style,
+		Low:   28,
+		High:  48,
+		prev:  33,
+	}
+}
+
+// near returns the note of a pitch class in the range closest to n.
+func (g *BassGenerator) near(pc float64, n float64) float64 {
+	pc += 12 * math.Round((n-pc)/12)
+	for pc < g.Low {
+		pc += 12
+	}
+	for pc > g.High {
+		pc -= 12
+	}
+	return pc
+}
+
+// root returns the root of the chord of a step, detuned like its notes.
+func root(s Step) float64 {
+	return s.Key.Tonic + s.Chord.Root() + detune(s)
+}
+
+// inRange returns the notes of the pitch classes of notes in the range of
+// the bass, in order.
+func (g *BassGenerator) inRange(notes Intervals) Intervals {
+	var r Intervals
+	for _, n := range notes {
+		for m := g.near(n, g.Low); m <= g.High; m += 12 {
+			if !contains(r, m) {
+				r = append(r, m)
+			}
+		}
+	}
+	sort.Float64s(r)
+	return r
+}
+
+// walk returns the two notes between a root and the approach to the next
+// root: chord tones of the step or, failing that, notes of its scale.
+func (g *BassGenerator) walk(s Step, from float64, to float64) (float64, float64) {
+	tones := g.inRange(s.Notes)
+	rising := to > from && pitchClass(to-s.Key.Tonic-detune(s)) == 0
+	scale := g.inRange(s.Key.Scale(s.Chord, rising).Add(detune(s)))
+	pick := func(target float64, not ...float64) float64 {
+		best, bestDist := from, math.Inf(1)
+		for _, set := range []Intervals{tones, scale} {
+			for _, n := range set {
+				if contains(Intervals(not), n) {
+					continue
+				}
+				if d := math.Abs(n - target); d < bestDist {
+					best, bestDist = n, d
+				}
+			}
+			if bestDist <= 2 {
+				break
+			}
+		}
+		return best
+	}
+	a := pick(from+(to-from)/3, from, to)
+	b := pick(from+2*(to-from)/3, a, to)
+	return a, b
+}
+
+// Line returns a bass line over a progression.
+func (g *BassGenerator) Line(p Progression) []Note {
+	var notes []Note
+	for i, s := range p.Steps {
+		r := g.near(root(s), g.prev)
+		next := r
+		if i+1 < len(p.Steps) {
+			next = g.near(root(p.Steps[i+1]), r)
+		}
+
+		var beats []beat
+		switch g.Style {
+		case WalkingBass:
+			approach := next - 1
+			if next < r {
+				approach = next + 1
+			}
+			a, b := g.walk(s, r, approach)
+			beats = []beat{
+				{0, 2, r, 0.9},
+				{2, 2, a, 0.7},
+				{4, 2, b, 0.8},
+				{6, 2, approach, 0.7},
+			}
+		case PedalBass:
+			tonic := g.near(s.Key.Tonic+detune(s), g.Low+6)
+			for e := 0; e < 8; e++ {
+				v := 0.6
+				if e%2 == 0 {
+					v = 0.8
+				}
+				beats = append(beats, beat{e, 1, tonic, v})
+			}
+		case SyncopatedBass:
+			octave := r + 12
+			if octave > g.High {
+				octave = r - 12
+			}
+			fifth := g.near(r+7, r)
+			beats = []beat{
+				{0, 3, r, 0.9},
+				{3, 2, r, 0.7},
+				{5, 1, octave, 0.6},
+				{6, 2, fifth, 0.8},
+			}
+			if rand.Intn(2) == 0 {
+				// anticipate the next chord
+				beats[3] = beat{7, 1, next, 0.8}
+			}
+		default:
+			fifth := g.near(r+7, r)
+			beats = []beat{
+				{0, 4, r, 0.9},
+				{4, 4, fifth, 0.7},
+			}
+		}
+
+		eighth := s.Duration / 8
+		for _, b := range beats {
+			n := Note{
+				Time:     s.Time + int64(b.at)*eighth,
+				Duration: int64(b.length) * eighth,
+				Pitch:    b.pitch,
+				Velocity: b.velocity,
+				Tone:     ChordTone,
+			}
+			if !contains(g.chordTones(s, n.Pitch), n.Pitch) {
+				n.Tone = PassingTone
+			}
+			notes = append(notes, n)
+		}
+		g.prev = r
+	}
+	return notes
+}
+
+// chordTones returns the notes of the chord of a step in the octave of n.
+func (g *BassGenerator) chordTones(s Step, n float64) Intervals {
+	var tones Intervals
+	for _, m := range s.Notes {
+		tones = append(tones, m+12*math.Round((n-m)/12))
+	}
+	return tones
+}
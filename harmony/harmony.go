@@ -0,0 +1,304 @@
+// Package harmony generates chord progressions with functional harmony.
+// Pitches are MIDI note numbers, and may be fractional.
+package harmony
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Intervals are pitches in semitones, either relative to a tonic or
+// absolute.
+type Intervals []float64
+
+func (i Intervals) Equal(j Intervals) bool {
+	if len(i) != len(j) {
+		return false
+	}
+	for k := range i {
+		if i[k] != j[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// Add returns the intervals transposed by g semitones.
+func (i Intervals) Add(g float64) Intervals {
+	var ret Intervals
+	for _, f := range i {
+		ret = append(ret, f+g)
+	}
+	return ret
+}
+
+// Expand returns the intervals in the octaves around them, in order.
+func (i Intervals) Expand() Intervals {
+	var exp []float64
+	for _, f := range i {
+		exp = append(exp, f, f-12, f+12, f-24)
+	}
+	sort.Float64s(exp)
+	return Intervals(exp)
+}
+
+// Scale is the notes of a scale relative to its tonic.
+type Scale Intervals
+
+var (
+	Major         = Scale{0, 2, 4, 5, 7, 9, 11}
+	NaturalMinor  = Scale{0, 2, 3, 5, 7, 8, 10}
+	HarmonicMinor = Scale{0, 2, 3, 5, 7, 8, 11}
+	MelodicMinor  = Scale{0, 2, 3, 5, 7, 9, 11}
+)
+
+// Key is a tonic and a mode.
+type Key struct {
+	Tonic float64
+	Minor bool
+}
+
+// Scale returns the notes of the key around the tonic over a chord, for a
+// line that rises to the tonic or not. Minor keys use the melodic minor
+// over chords with its raised sixth, the harmonic minor over dominants and
+// chords with its leading tone, the melodic minor again for lines rising
+// to the tonic, and the natural minor otherwise.
+func (k Key) Scale(c Chord, rising bool) Intervals {
+	return Intervals(k.scale(c, rising)).Add(k.Tonic).Expand()
+}
+
+func (k Key) scale(c Chord, rising bool) Scale {
+	if !k.Minor {
+		return Major
+	}
+	has := func(pc float64) bool { return hasPitchClass(c.Notes, pc) }
+	switch {
+	case has(9):
+		return MelodicMinor
+	case has(11), c.Function == Dominant && !has(10):
+		return HarmonicMinor
+	case rising && !has(8) && !has(10):
+		return MelodicMinor
+	}
+	return NaturalMinor
+}
+
+// Parallel returns the key with the same tonic in the other mode.
+func (k Key) Parallel() Key {
+	return Key{Tonic: k.Tonic, Minor: !k.Minor}
+}
+
+// Relative returns the key with the same notes in the other mode.
+func (k Key) Relative() Key {
+	if k.Minor {
+		return Key{Tonic: k.Tonic + 3}.normalize()
+	}
+	return Key{Tonic: k.Tonic - 3, Minor: true}.normalize()
+}
+
+// Transpose returns the key moved by a number of semitones.
+func (k Key) Transpose(semitones float64) Key {
+	return Key{Tonic: k.Tonic + semitones, Minor: k.Minor}.normalize()
+}
+
+// normalize moves the tonic to the octave around A4.
+func (k Key) normalize() Key {
+	for k.Tonic < 63 {
+		k.Tonic += 12
+	}
+	for k.Tonic >= 75 {
+		k.Tonic -= 12
+	}
+	return k
+}
+
+// Chords returns the chords of the key with a function.
+func (k Key) Chords(f HarmonicFunction) []Chord {
+	if k.Minor {
+		return minorFunctionMap[f]
+	}
+	return functionMap[f]
+}
+
+// Substitutes returns chords that can stand in for the chords of the key
+// with a function.
+func (k Key) Substitutes(f HarmonicFunction) []Chord {
+	if k.Minor {
+		switch f {
+		case Tonic:
+			return []Chord{
+				c_VI7,
+				c_i6,
+			}
+		case Subdominant:
+			return []Chord{
+				c_IV7_mel,
+				c_N6,
+			}
+		case Dominant:
+			return []Chord{
+				c_v7,
+				c_bII7,
+				c_V7sus4,
+			}
+		}
+		return nil
+	}
+	switch f {
+	case Tonic:
+		return []Chord{
+			c_vi7,
+			c_I6,
+		}
+	case Dominant:
+		return []Chord{
+			c_ii7b5,
+			c_bIII_aug_7,
+			c_V7sus4,
+		}
+	}
+	return nil
+}
+
+// Chord is a chord of a key, with its notes relative to the tonic.
+type Chord struct {
+	Name     string // Name is the Roman numeral of the chord
+	Function HarmonicFunction
+	Notes    Intervals
+}
+
+// In returns the notes of the chord in a key.
+func (c Chord) In(k Key) Intervals {
+	return c.Notes.Add(k.Tonic)
+}
+
+// Root returns the root of the chord relative to the tonic, read from the
+// Roman numeral at the start of its name. A chord without a numeral has
+// its first note as root.
+func (c Chord) Root() float64 {
+	if root, ok := numeralRoot(c.Name); ok {
+		return root
+	}
+	if len(c.Notes) > 0 {
+		return c.Notes[0]
+	}
+	return 0
+}
+
+var (
+	c_I          = Chord{"I", Tonic, Intervals{0, 4, 7}}
+	c_iii7       = Chord{"iii7", Other, Intervals{2, 4, 7, 11}}
+	c_vi7        = Chord{"vi7", Other, Intervals{-3, 0, 4, 7}}
+	c_I6         = Chord{"I6", Tonic, Intervals{0, 4, 7, 9}}
+	c_ii7        = Chord{"ii7", Subdominant, Intervals{0, 2, 5, 9}}
+	c_IV7        = Chord{"IVmaj7", Subdominant, Intervals{0, 4, 5, 9}}
+	c_V7         = Chord{"V7", Dominant, Intervals{2, 5, 7, 11}}
+	c_vii_dim_7  = Chord{"viiø7", Dominant, Intervals{-1, 2, 5, 9}}
+	c_ii7b5      = Chord{"iiø7", Dominant, Intervals{0, 2, 5, 8}}
+	c_bIII_aug_7 = Chord{"bIII+maj7", Dominant, Intervals{2, 3, 7, 11}}
+	c_V7sus4     = Chord{"V7sus4", Dominant, Intervals{2, 5, 7, 12}}
+
+	// chords of natural minor
+	c_i        = Chord{"i", Tonic, Intervals{0, 3, 7}}
+	c_ii_dim_7 = Chord{"iiø7", Subdominant, Intervals{0, 2, 5, 8}}
+	c_III_7    = Chord{"bIIImaj7", Other, Intervals{2, 3, 7, 10}}
+	c_iv7      = Chord{"iv7", Subdominant, Intervals{0, 3, 5, 8}}
+	c_v7       = Chord{"v7", Dominant, Intervals{2, 5, 7, 10}}
+	c_VI7      = Chord{"bVImaj7", Other, Intervals{0, 3, 7, 8}}
+	c_vii_7    = Chord{"bVII7", Other, Intervals{2, 5, 8, 10}}
+
+	// chords of harmonic minor
+	c_vii_o7 = Chord{"viio7", Dominant, Intervals{-1, 2, 5, 8}}
+
+	// chords of melodic minor
+	c_i6      = Chord{"i6", Tonic, Intervals{0, 3, 7, 9}}
+	c_IV7_mel = Chord{"IV7", Subdominant, Intervals{0, 3, 5, 9}}
+
+	// chromatic chords; the Neapolitan sixth is named bII, since 6 adds a
+	// sixth to a numeral
+	c_N6   = Chord{"bII", Subdominant, Intervals{1, 5, 8}}
+	c_bII7 = Chord{"bII7", Dominant, Intervals{-1, 1, 5, 8}}
+)
+
+// DominantSeventh is the V7 chord, which leads to the tonic of a key.
+var DominantSeventh = c_V7
+
+var functionMap = map[HarmonicFunction][]Chord{
+	Tonic:       {c_I},
+	Subdominant: {c_ii7, c_IV7},
+	Dominant:    {c_V7, c_vii_dim_7},
+	Other:       {c_iii7, c_vi7},
+}
+
+var minorFunctionMap = map[HarmonicFunction][]Chord{
+	Tonic:       {c_i},
+	Subdominant: {c_ii_dim_7, c_iv7},
+	Dominant:    {c_V7, c_vii_o7},
+	Other:       {c_III_7, c_VI7, c_vii_7},
+}
+
+// HarmonicFunction is the role of a chord in a key.
+type HarmonicFunction int
+
+const (
+	Tonic HarmonicFunction = iota
+	Subdominant
+	Dominant
+	Other
+)
+
+var functionNames = []string{"tonic", "subdominant", "dominant", "other"}
+
+func (f HarmonicFunction) String() string {
+	if f >= 0 && int(f) < len(functionNames) {
+		return functionNames[f]
+	}
+	return "unknown"
+}
+
+func (f HarmonicFunction) MarshalText() ([]byte, error) {
+	if f < 0 || int(f) >= len(functionNames) {
+		return nil, fmt.Errorf("unknown harmonic function %d", int(f))
+	}
+	return []byte(functionNames[f]), nil
+}
+
+func (f *HarmonicFunction) UnmarshalText(text []byte) error {
+	for i, name := range functionNames {
+		if string(text) == name {
+			*f = HarmonicFunction(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown harmonic function %q", text)
+}
+
+// Following returns the functions that can follow f.
+func (f HarmonicFunction) Following() []HarmonicFunction {
+	switch f {
+	case Tonic:
+		return []HarmonicFunction{Subdominant, Dominant, Other}
+	case Subdominant:
+		return []HarmonicFunction{Tonic, Dominant, Other}
+	case Dominant:
+		return []HarmonicFunction{Tonic}
+	case Other:
+		return []HarmonicFunction{Tonic, Subdominant, Dominant}
+	}
+	panic("unknown harmonic function")
+}
+
+// Between returns the functions that can follow prev and be followed by
+// next.
+func Between(prev HarmonicFunction, next HarmonicFunction) []HarmonicFunction {
+	var funcs []HarmonicFunction
+	for _, f := range prev.Following() {
+		for _, g := range f.Following() {
+			if g == next {
+				funcs = append(funcs, f)
+				break
+			}
+		}
+	}
+	return funcs
+}
@@ -0,0 +1,385 @@
+package harmony
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Tone is the role of a note of a melody against its chord.
+type Tone string
+
+const (
+	ChordTone     Tone = "chord"
+	PassingTone   Tone = "passing"   // PassingTone moves by step between two notes
+	NeighbourTone Tone = "neighbour" // NeighbourTone moves by step away from a note and back
+)
+
+// Contour is the overall shape of a melody over a repetition of a
+// progression.
+type Contour string
+
+const (
+	ArchContour    Contour = "arch"
+	RisingContour  Contour = "rise"
+	FallingContour Contour = "fall"
+)
+
+// height returns the height of the contour from 0 to 1 at a position from
+// 0 to 1.
+func (c Contour) height(t float64) float64 {
+	switch c {
+	case RisingContour:
+		return t
+	case FallingContour:
+		return 1 - t
+	}
+	return math.Sin(math.Pi * t)
+}
+
+// Note is a note of a melody.
+type Note struct {
+	Time     int64 // Time is when the note starts, in samples
+	Duration int64
+	Pitch    float64
+	Velocity float64
+	Tone     Tone
+}
+
+// Motif is a rhythm of the onsets of the notes over a chord, in
+// subdivisions of the chord.
+type Motif []int
+
+// rhythmCells are the rhythms of half a chord of four subdivisions.
+var rhythmCells = []Motif{
+	{0},
+	{0, 2},
+	{0, 2},
+	{0, 3},
+	{0, 2, 3},
+	{0, 1, 2},
+	{0, 1, 2, 3},
+}
+
+// MelodyGenerator writes melodies over progressions, continuing from the
+// previous melody.
+type MelodyGenerator struct {
+	Low, High float64 // Low and High are the range of the melody
+	// MaxLeap is the largest interval between chord tones, unless no
+	// chord tone is that close.
+	MaxLeap float64
+	Contour Contour
+	// Subdivisions is the number of positions for notes in a chord, a
+	// multiple of eight.
+	Subdivisions int
+	// Variation is the chance that a chord of a repetition after the
+	// first changes its rhythm and notes.
+	Variation float64
+
+	prev float64
+}
+
+// NewMelodyGenerator returns a generator of melodies above the chords of a
+// Generator.
+func NewMelodyGenerator() *MelodyGenerator {
+	return &MelodyGenerator{
+		Low:          64,
+		High:         84,
+		MaxLeap:      7,
+		Contour:      ArchContour,
+		Subdivisions: 8,
+		Variation:    0.3,
+		prev:         72,
+	}
+}
+
+// Validate returns an error if the generator cannot write melodies.
+func (g *MelodyGenerator) Validate() error {
+	if g.Subdivisions <= 0 || g.Subdivisions%8 != 0 {
+		return fmt.Errorf("subdivisions %d is not a positive multiple of 8", g.Subdivisions)
+	}
+	if g.Low >= g.High {
+		return fmt.Errorf("range %g to %g is empty", g.Low, g.High)
+	}
+	return nil
+}
+
+// motif returns a rhythm of two cells over a chord.
+func (g *MelodyGenerator) motif() Motif {
+	scale := g.Subdivisions / 8
+	var m Motif
+	for half := 0; half < 2; half++ {
+		for _, o := range rhythmCells[rand.Intn(len(rhythmCells))] {
+			m = append(m, (half*4+o)*scale)
+		}
+	}
+	return m
+}
+
+// vary returns the motif with a weak onset added or removed.
+func (g *MelodyGenerator) vary(m Motif) Motif {
+	half := g.Subdivisions / 2
+	o := 1 + rand.Intn(g.Subdivisions-1)
+	if o == half {
+		return m
+	}
+	var v Motif
+	found := false
+	for _, p := range m {
+		if p == o {
+			found = true
+		} else {
+			v = append(v, p)
+		}
+	}
+	if !found {
+		v = append(v, o)
+		sort.Ints(v)
+	}
+	return v
+}
+
+// detune returns the offset of the notes of a step from the semitones.
+func detune(s Step) float64 {
+	if len(s.Notes) == 0 {
+		return 0
+	}
+	return s.Notes[0] - math.Floor(s.Notes[0])
+}
+
+// chordTones returns the notes of a step in the range of the melody.
+func (g *MelodyGenerator) chordTones(s Step) Intervals {
+	var tones Intervals
+	for _, n := range s.Notes {
+		for n-12 >= g.Low {
+			n -= 12
+		}
+		for n < g.Low {
+			n += 12
+		}
+		for ; n <= g.High; n += 12 {
+			if !contains(tones, n) {
+				tones = append(tones, n)
+			}
+		}
+	}
+	sort.Float64s(tones)
+	return tones
+}
+
+// scaleTones returns the notes of the key of a step in the range of the
+// melody, for a line that rises to the tonic or not.
+func (g *MelodyGenerator) scaleTones(s Step, rising bool) Intervals {
+	var tones Intervals
+	for _, n := range s.Key.Scale(s.Chord, rising).Add(detune(s)) {
+		for o := -24.0; o <= 24; o += 12 {
+			if m := n + o; m >= g.Low && m <= g.High && !contains(tones, m) {
+				tones = append(tones, m)
+			}
+		}
+	}
+	sort.Float64s(tones)
+	return tones
+}
+
+// chordTone returns the chord tone of a step closest to a target height
+// without leaping far from the previous note.
+func (g *MelodyGenerator) chordTone(s Step, target float64, prev float64) float64 {
+	best, bestCost := prev, math.Inf(1)
+	for _, n := range g.chordTones(s) {
+		leap := math.Abs(n - prev)
+		cost := math.Abs(n-target) + 0.3*leap + 2*rand.Float64()
+		if leap > g.MaxLeap {
+			cost += 10
+		}
+		if cost < bestCost {
+			best, bestCost = n, cost
+		}
+	}
+	return best
+}
+
+// nearest returns the index of the note of tones closest to n.
+func nearest(tones Intervals, n float64) int {
+	i := sort.SearchFloat64s(tones, n)
+	if i == len(tones) || i > 0 && n-tones[i-1] < tones[i]-n {
+		i--
+	}
+	return i
+}
+
+// fill returns k notes of a scale that lead from a to b by step.
+func (g *MelodyGenerator) fill(tones Intervals, a float64, b float64, k int) []float64 {
+	ia, ib := nearest(tones, a), nearest(tones, b)
+	dir := 1
+	if ib < ia || ib == ia && a > (g.Low+g.High)/2 {
+		dir = -1
+	}
+	d := ib - ia
+	if d < 0 {
+		d = -d
+	}
+	if d == 0 {
+		d = 1
+	}
+
+	ns := make([]float64, k)
+	for j := 1; j <= k; j++ {
+		i := ia + dir*j
+		if j >= d {
+			// circle around b with its neighbour
+			if (j-d)%2 == 0 {
+				i = ib + dir
+			} else {
+				i = ib
+			}
+		}
+		if i < 0 {
+			i = 0
+		} else if i >= len(tones) {
+			i = len(tones) - 1
+		}
+		ns[j-1] = tones[i]
+	}
+	return ns
+}
+
+// onset is a note of a melody before its pitch is known.
+type onset struct {
+	step   int // step is the index of the chord
+	slot   int // slot is the position in the chord
+	strong bool
+}
+
+// Melody returns a melody over a progression. The first repetition of the
+// progression sets the motifs, which the other repetitions repeat or vary.
+// A generator that is not valid writes no notes.
+func (g *MelodyGenerator) Melody(p Progression) []Note {
+	if g.Validate() != nil {
+		return nil
+	}
+	length := p.Length
+	if length <= 0 || length > len(p.Steps) {
+		length = len(p.Steps)
+	}
+	if length == 0 {
+		return nil
+	}
+	reps := (len(p.Steps) + length - 1) / length
+
+	motifs := make([]Motif, length)
+	for j := range motifs {
+		motifs[j] = g.motif()
+	}
+
+	var notes []Note
+	var first []float64 // first is the chord tones of the first repetition
+	for r := 0; r < reps; r++ {
+		steps := p.Steps[r*length:]
+		if len(steps) > length {
+			steps = steps[:length]
+		}
+
+		var onsets []onset
+		var strong []float64
+		prev := g.prev
+		for j, s := range steps {
+			m := motifs[j]
+			varied := r == 0 ||
+				!s.Notes.Equal(p.Steps[j].Notes) ||
+				rand.Float64() < g.Variation
+			if r > 0 && varied {
+				m = g.vary(m)
+			}
+			if r == reps-1 && j == len(steps)-1 {
+				// end on a long note
+				m = Motif{0}
+			}
+
+			for _, o := range m {
+				strong := o%(g.Subdivisions/2) == 0
+				onsets = append(onsets, onset{step: j, slot: o, strong: strong})
+			}
+			for k := 0; k < 2; k++ {
+				var n float64
+				if varied {
+					t := (float64(j) + float64(k)/2) / float64(length)
+					target := g.Low + (g.High-g.Low)*(0.25+0.5*g.Contour.height(t))
+					if r > 0 {
+						// vary around the note of the first repetition
+						target = first[j*2+k] + float64(3-rand.Intn(7))
+					}
+					n = g.chordTone(s, target, prev)
+				} else {
+					n = first[j*2+k]
+				}
+				strong = append(strong, n)
+				prev = n
+			}
+		}
+		if r == 0 {
+			first = strong
+		}
+
+		// place chord tones on strong onsets and lead between them
+		pitches := make([]float64, len(onsets))
+		var run []int
+		flush := func(next float64) {
+			if len(run) == 0 {
+				return
+			}
+			s := steps[onsets[run[0]].step]
+			a := pitches[run[0]-1]
+			rising := next > a && pitchClass(next-s.Key.Tonic-detune(s)) == 0
+			for i, n := range g.fill(g.scaleTones(s, rising), a, next, len(run)) {
+				pitches[run[i]] = n
+			}
+			run = run[:0]
+		}
+		for i, o := range onsets {
+			if !o.strong {
+				run = append(run, i)
+				continue
+			}
+			pitches[i] = strong[o.step*2+o.slot/(g.Subdivisions/2)]
+			flush(pitches[i])
+		}
+		if len(run) > 0 {
+			// hold around the last chord tone
+			flush(pitches[run[0]-1])
+		}
+
+		for i, o := range onsets {
+			s := steps[o.step]
+			unit := s.Duration / int64(g.Subdivisions)
+			end := s.Time + s.Duration
+			if i+1 < len(onsets) {
+				next := steps[onsets[i+1].step]
+				end = next.Time + int64(onsets[i+1].slot)*unit
+			}
+			n := Note{
+				Time:     s.Time + int64(o.slot)*unit,
+				Pitch:    pitches[i],
+				Velocity: 0.65,
+				Tone:     ChordTone,
+			}
+			n.Duration = end - n.Time
+			if o.slot == 0 {
+				n.Velocity = 0.9
+			} else if o.strong {
+				n.Velocity = 0.8
+			}
+			if !contains(g.chordTones(s), n.Pitch) {
+				n.Tone = NeighbourTone
+				if i > 0 && i+1 < len(onsets) &&
+					(pitches[i-1]-n.Pitch)*(n.Pitch-pitches[i+1]) > 0 {
+					n.Tone = PassingTone
+				}
+			}
+			notes = append(notes, n)
+		}
+		g.prev = pitches[len(pitches)-1]
+	}
+	return notes
+}
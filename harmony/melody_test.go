@@ -0,0 +1,34 @@
+package harmony
+
+import "testing"
+
+func TestMelodyValidate(t *testing.T) {
+	for _, n := range []int{-8, 0, 1, 4, 12} {
+		g := NewMelodyGenerator()
+		g.Subdivisions = n
+		if g.Validate() == nil {
+			t.Errorf("%d subdivisions are valid", n)
+		}
+		if notes := g.Melody(NewGenerator(Key{Tonic: 60}, Classic).Next(2, 4)); notes != nil {
+			t.Errorf("%d subdivisions wrote %d notes", n, len(notes))
+		}
+	}
+}
+
+func TestMelodyRange(t *testing.T) {
+	for _, n := range []int{8, 16} {
+		g := NewMelodyGenerator()
+		g.Subdivisions = n
+		if err := g.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		pg := NewGenerator(Key{Tonic: 60}, Classic)
+		for i := 0; i < 20; i++ {
+			for _, note := range g.Melody(pg.Next(2, 4)) {
+				if note.Pitch < g.Low-12 || note.Pitch > g.High+12 {
+					t.Errorf("%d subdivisions: pitch %g is far outside %g to %g", n, note.Pitch, g.Low, g.High)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package harmony
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	sharpNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+	flatNames  = []string{"C", "Db", "D", "Eb", "E", "F", "Gb", "G", "Ab", "A", "Bb", "B"}
+	// chordNames are the usual roots of chord symbols without a key
+	chordNames = []string{"C", "Db", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+)
+
+// letters are the pitch classes of the letters of note names.
+var letters = map[byte]float64{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
+
+// noteName returns the name of a note, with its octave if octave is set
+// and the cents that it is detuned by if any.
+func noteName(n float64, names []string, octave bool) string {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return fmt.Sprint(n)
+	}
+	r := math.Ceil(n - 0.5)
+	s := names[int(pitchClass(r))]
+	if octave {
+		s += strconv.Itoa(int(math.Floor(r/12)) - 1)
+	}
+	if cents := math.Round((n - r) * 100); cents != 0 {
+		s += fmt.Sprintf("%+g", cents)
+	}
+	return s
+}
+
+// NoteName returns the name of a note with sharps, like C#4 for 61, or
+// A4+50 for a note detuned by half a semitone.
+func NoteName(n float64) string {
+	return noteName(n, sharpNames, true)
+}
+
+// parsePitchClass returns the pitch class of the note name at the start
+// of s and the rest of s.
+func parsePitchClass(s string) (float64, string, error) {
+	if s == "" {
+		return 0, "", fmt.Errorf("empty note name")
+	}
+	pc, ok := letters[s[0]]
+	if !ok {
+		return 0, "", fmt.Errorf("%q does not start with a note", s)
+	}
+	i := 1
+	for ; i < len(s); i++ {
+		if s[i] == '#' {
+			pc++
+		} else if s[i] == 'b' {
+			pc--
+		} else {
+			break
+		}
+	}
+	return pc, s[i:], nil
+}
+
+// ParseNote returns the note of a name like C#4, Bb3 or A4+50, where C4
+// is middle C.
+func ParseNote(s string) (float64, error) {
+	pc, rest, err := parsePitchClass(s)
+	if err != nil {
+		return 0, err
+	}
+	end := 0
+	if strings.HasPrefix(rest, "-") {
+		end++
+	}
+	for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+		end++
+	}
+	octave, err := strconv.Atoi(rest[:end])
+	if err != nil {
+		return 0, fmt.Errorf("note %q has no octave", s)
+	}
+	n := pc + float64(12*(octave+1))
+	if rest = rest[end:]; rest != "" {
+		cents, err := strconv.ParseFloat(rest, 64)
+		if err != nil || (rest[0] != '+' && rest[0] != '-') || math.IsNaN(cents) || math.IsInf(cents, 0) {
+			return 0, fmt.Errorf("note %q has unknown cents %q", s, rest)
+		}
+		n += cents / 100
+	}
+	return n, nil
+}
+
+// names returns the names of the pitch classes with the accidentals of
+// the key signature.
+func (k Key) names() []string {
+	pc := pitchClass(k.Tonic)
+	if k.Minor {
+		pc = pitchClass(pc + 3)
+	}
+	switch pc {
+	case 1, 3, 5, 8, 10:
+		return flatNames
+	}
+	return sharpNames
+}
+
+// NoteName returns the name of a note spelled in the key.
+func (k Key) NoteName(n float64) string {
+	return noteName(n, k.names(), true)
+}
+
+// NoteNames returns the names of notes spelled in the key.
+func (k Key) NoteNames(notes Intervals) []string {
+	var s []string
+	for _, n := range notes {
+		s = append(s, k.NoteName(n))
+	}
+	return s
+}
+
+// String returns the name of the key, like F# minor.
+func (k Key) String() string {
+	mode := "major"
+	if k.Minor {
+		mode = "minor"
+	}
+	return noteName(k.Tonic, k.names(), false) + " " + mode
+}
+
+// ParseKey returns the key of a name like A, F# minor, Bbm or C4 major.
+// A tonic without an octave is in the octave around A4.
+func ParseKey(s string) (Key, error) {
+	var k Key
+	name := strings.TrimSpace(s)
+	switch {
+	case strings.HasSuffix(name, " minor"):
+		k.Minor = true
+		name = strings.TrimSuffix(name, " minor")
+	case strings.HasSuffix(name, " major"):
+		name = strings.TrimSuffix(name, " major")
+	case strings.HasSuffix(name, "m"):
+		k.Minor = true
+		name = strings.TrimSuffix(name, "m")
+	}
+	pc, rest, err := parsePitchClass(name)
+	if err != nil {
+		return Key{}, fmt.Errorf("key %q: %v", s, err)
+	}
+	if rest == "" {
+		k.Tonic = pc
+		return k.normalize(), nil
+	}
+	if k.Tonic, err = ParseNote(name); err != nil {
+		return Key{}, fmt.Errorf("key %q: %v", s, err)
+	}
+	return k, nil
+}
+
+// quality is a kind of chord.
+type quality struct {
+	symbol  string // symbol follows the root of a chord symbol
+	numeral string // numeral follows a Roman numeral, in lower case if minor
+	minor   bool
+	notes   Intervals // notes are relative to the root
+}
+
+var qualities = []quality{
+	{"", "", false, Intervals{0, 4, 7}},
+	{"m", "", true, Intervals{0, 3, 7}},
+	{"dim", "o", true, Intervals{0, 3, 6}},
+	{"aug", "+", false, Intervals{0, 4, 8}},
+	{"sus2", "sus2", false, Intervals{0, 2, 7}},
+	{"sus4", "sus4", false, Intervals{0, 5, 7}},
+	{"6", "6", false, Intervals{0, 4, 7, 9}},
+	{"m6", "6", true, Intervals{0, 3, 7, 9}},
+	{"7", "7", false, Intervals{0, 4, 7, 10}},
+	{"maj7", "maj7", false, Intervals{0, 4, 7, 11}},
+	{"m7", "7", true, Intervals{0, 3, 7, 10}},
+	{"mMaj7", "maj7", true, Intervals{0, 3, 7, 11}},
+	{"m7b5", "ø7", true, Intervals{0, 3, 6, 10}},
+	{"dim7", "o7", true, Intervals{0, 3, 6, 9}},
+	{"7sus4", "7sus4", false, Intervals{0, 5, 7, 10}},
+	{"7#5", "+7", false, Intervals{0, 4, 8, 10}},
+	{"maj7#5", "+maj7", false, Intervals{0, 4, 8, 11}},
+	{"6/9", "6/9", false, Intervals{0, 4, 7, 9, 14}},
+	{"9", "9", false, Intervals{0, 4, 7, 10, 14}},
+	{"maj9", "maj9", false, Intervals{0, 4, 7, 11, 14}},
+	{"m9", "9", true, Intervals{0, 3, 7, 10, 14}},
+	{"7b9", "7b9", false, Intervals{0, 4, 7, 10, 13}},
+	{"13", "13", false, Intervals{0, 4, 7, 10, 14, 21}},
+}
+
+// seventh returns the seventh of the quality relative to its root.
+func (q quality) seventh() (float64, bool) {
+	for _, n := range q.notes {
+		if n == 10 || n == 11 || (n == 9 && q.symbol == "dim7") {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// symbolAliases are other ways to write the qualities of chord symbols.
+var symbolAliases = map[string]string{
+	"maj":     "",
+	"M":       "",
+	"min":     "m",
+	"-":       "m",
+	"o":       "dim",
+	"+":       "aug",
+	"sus":     "sus4",
+	"M7":      "maj7",
+	"-7":      "m7",
+	"min7":    "m7",
+	"mM7":     "mMaj7",
+	"m(maj7)": "mMaj7",
+	"ø":       "m7b5",
+	"ø7":      "m7b5",
+	"o7":      "dim7",
+	"+7":      "7#5",
+	"aug7":    "7#5",
+	"+maj7":   "maj7#5",
+}
+
+// symbolQuality returns the quality written after the root of a chord
+// symbol.
+func symbolQuality(suffix string) (quality, bool) {
+	if s, ok := symbolAliases[suffix]; ok {
+		suffix = s
+	}
+	for _, q := range qualities {
+		if q.symbol == suffix {
+			return q, true
+		}
+	}
+	return quality{}, false
+}
+
+// pitchClasses returns the pitch classes of notes relative to a root.
+func pitchClasses(notes Intervals, root float64) map[float64]bool {
+	pcs := make(map[float64]bool)
+	for _, n := range notes {
+		pcs[pitchClass(n-root)] = true
+	}
+	return pcs
+}
+
+func samePitchClasses(a map[float64]bool, b map[float64]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for pc := range a {
+		if !b[pc] {
+			return false
+		}
+	}
+	return true
+}
+
+// identify returns the root and quality of notes, trying the preferred
+// roots first and then the notes from the lowest. Extended chords may
+// leave out the fifth.
+func identify(notes Intervals, prefer ...float64) (float64, quality, bool) {
+	notes = undetuned(notes)
+	sorted := append(Intervals(nil), notes...)
+	sort.Float64s(sorted)
+	for _, root := range append(prefer, sorted...) {
+		pcs := pitchClasses(notes, root)
+		withFifth := pitchClasses(append(Intervals{root + 7}, notes...), root)
+		for _, q := range qualities {
+			qs := pitchClasses(q.notes, 0)
+			if samePitchClasses(pcs, qs) || (len(q.notes) >= 5 && samePitchClasses(withFifth, qs)) {
+				return pitchClass(root), q, true
+			}
+		}
+	}
+	return 0, quality{}, false
+}
+
+// symbol returns the chord symbol of notes spelled with names, over the
+// lowest note if slash is set.
+func symbol(notes Intervals, names []string, slash bool, prefer ...float64) string {
+	root, q, ok := identify(notes, prefer...)
+	if !ok {
+		return ""
+	}
+	s := noteName(root, names, false) + q.symbol
+	if slash {
+		bass := undetuned(notes)
+		sort.Float64s(bass)
+		if pitchClass(bass[0]) != root {
+			s += "/" + noteName(bass[0], names, false)
+		}
+	}
+	return s
+}
+
+// ChordSymbol returns the chord symbol of notes, like Am7/C or Bbmaj7, or
+// an empty string if they are not a known chord.
+func ChordSymbol(notes Intervals) string {
+	return symbol(notes, chordNames, true)
+}
+
+// Symbol returns the chord symbol of the chord in a key, spelled with the
+// accidental of its Roman numeral or else of the key.
+func (c Chord) Symbol(k Key) string {
+	names := k.names()
+	if strings.HasPrefix(c.Name, "b") {
+		names = flatNames
+	} else if strings.HasPrefix(c.Name, "#") {
+		names = sharpNames
+	}
+	return symbol(c.In(k), names, false, k.Tonic+c.Root())
+}
+
+// ParseChordSymbol returns the notes of a chord symbol like Cmaj7,
+// F#m7b5, G7sus4 or Am/C, with the root in the octave of middle C and the
+// bass note below it.
+func ParseChordSymbol(s string) (Intervals, error) {
+	name, bass := s, ""
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		if _, rest, err := parsePitchClass(s[i+1:]); err == nil && rest == "" {
+			name, bass = s[:i], s[i+1:]
+		}
+	}
+	root, suffix, err := parsePitchClass(name)
+	if err != nil {
+		return nil, fmt.Errorf("chord symbol %q: %v", s, err)
+	}
+	q, ok := symbolQuality(suffix)
+	if !ok {
+		return nil, fmt.Errorf("chord symbol %q: unknown quality %q", s, suffix)
+	}
+	notes := q.notes.Add(60 + root)
+	if bass != "" {
+		b, _, _ := parsePitchClass(bass)
+		b += 60
+		for b >= notes[0] {
+			b -= 12
+		}
+		notes = append(Intervals{b}, notes...)
+	}
+	return notes, nil
+}
+
+// numerals are the Roman numerals of the degrees of the major scale, with
+// the numerals that start others last.
+var numerals = []struct {
+	numeral string
+	degree  int
+}{
+	{"vii", 6},
+	{"vi", 5},
+	{"v", 4},
+	{"iv", 3},
+	{"iii", 2},
+	{"ii", 1},
+	{"i", 0},
+}
+
+// degreeNumerals are the Roman numerals of the notes of the chromatic
+// scale.
+var degreeNumerals = []string{"I", "bII", "II", "bIII", "III", "IV", "#IV", "V", "bVI", "VI", "bVII", "VII"}
+
+// splitNumeral returns the root relative to the tonic of the Roman
+// numeral at the start of s, as a degree of the major scale lowered by
+// flats and raised by sharps, whether it is lower case and the rest of s.
+func splitNumeral(s string) (float64, bool, string, bool) {
+	var shift float64
+	for len(s) > 0 && (s[0] == 'b' || s[0] == '#') {
+		if s[0] == 'b' {
+			shift--
+		} else {
+			shift++
+		}
+		s = s[1:]
+	}
+	for _, n := range numerals {
+		if strings.HasPrefix(s, n.numeral) {
+			return Major[n.degree] + shift, true, s[len(n.numeral):], true
+		}
+		if strings.HasPrefix(s, strings.ToUpper(n.numeral)) {
+			return Major[n.degree] + shift, false, s[len(n.numeral):], true
+		}
+	}
+	return 0, false, "", false
+}
+
+// parseNumeral returns the root relative to the tonic and the quality of
+// a Roman numeral, and whether it is a secondary chord like V7/V.
+func parseNumeral(s string) (float64, quality, bool, error) {
+	for i := range s {
+		if s[i] != '/' {
+			continue
+		}
+		of, _, _, err := parseNumeral(s[i+1:])
+		if err != nil {
+			// like the 9 of I6/9
+			continue
+		}
+		root, q, _, err := parseNumeral(s[:i])
+		return pitchClass(root + of), q, true, err
+	}
+	root, lower, suffix, ok := splitNumeral(s)
+	if !ok {
+		return 0, quality{}, false, fmt.Errorf("%q is not a Roman numeral", s)
+	}
+	for _, q := range qualities {
+		if q.minor == lower && q.numeral == suffix {
+			return root, q, false, nil
+		}
+	}
+	if q, ok := symbolQuality(suffix); ok {
+		return root, q, false, nil
+	}
+	return 0, quality{}, false, fmt.Errorf("%q has unknown quality %q", s, suffix)
+}
+
+// numeralRoot returns the root relative to the tonic of the Roman numeral
+// of a chord name, also when it does not name a known chord.
+func numeralRoot(name string) (float64, bool) {
+	if root, _, _, err := parseNumeral(name); err == nil {
+		return root, true
+	}
+	root, _, _, ok := splitNumeral(strings.ToLower(name))
+	return root, ok
+}
+
+// ParseNumeral returns the chord of a Roman numeral like ii7, V7/V or
+// bVI. Numerals are degrees of the major scale in both modes, so the
+// third of a minor key is bIII.
+func ParseNumeral(s string) (Chord, error) {
+	root, q, secondary, err := parseNumeral(s)
+	if err != nil {
+		return Chord{}, err
+	}
+	f := Other
+	switch {
+	case secondary:
+		f = Dominant
+	case root == 0:
+		f = Tonic
+	case root == 2 || root == 5:
+		f = Subdominant
+	case root == 7 || root == 11:
+		f = Dominant
+	}
+	return Chord{Name: s, Function: f, Notes: q.notes.Add(root)}, nil
+}
+
+// Numeral returns the Roman numeral of notes in the key, or an empty
+// string if they are not a known chord.
+func (k Key) Numeral(notes Intervals) string {
+	root, q, ok := identify(notes)
+	if !ok {
+		return ""
+	}
+	n := degreeNumerals[int(pitchClass(root-k.Tonic))]
+	if q.minor {
+		n = strings.ToLower(n)
+	}
+	return n + q.numeral
+}
@@ -0,0 +1,135 @@
+package harmony
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNoteNames(t *testing.T) {
+	tests := []struct {
+		name string
+		note float64
+	}{
+		{"C4", 60},
+		{"C#4", 61},
+		{"Bb3", 58},
+		{"A4", 69},
+		{"A4+50", 69.5},
+		{"C-1", 0},
+	}
+	for _, tt := range tests {
+		n, err := ParseNote(tt.name)
+		if err != nil || n != tt.note {
+			t.Errorf("ParseNote(%q) = %g, %v, want %g", tt.name, n, err, tt.note)
+		}
+	}
+	for _, tt := range tests {
+		if tt.name == "Bb3" {
+			continue
+		}
+		if s := NoteName(tt.note); s != tt.name {
+			t.Errorf("NoteName(%g) = %q, want %q", tt.note, s, tt.name)
+		}
+	}
+	if s := (Key{Tonic: 65}).NoteName(58); s != "Bb3" {
+		t.Errorf("NoteName(58) in F = %q, want Bb3", s)
+	}
+}
+
+func TestParseNoteErrors(t *testing.T) {
+	for _, s := range []string{"", "H4", "C", "A4+Inf", "A4+NaN", "A4-Inf", "A4+x"} {
+		if n, err := ParseNote(s); err == nil {
+			t.Errorf("ParseNote(%q) = %g, want an error", s, n)
+		}
+	}
+	for _, n := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		NoteName(n)
+	}
+}
+
+func TestChordSymbols(t *testing.T) {
+	tests := []struct {
+		symbol string
+		notes  Intervals
+	}{
+		{"Cmaj7", Intervals{60, 64, 67, 71}},
+		{"F#m7b5", Intervals{66, 69, 72, 76}},
+		{"G7sus4", Intervals{67, 72, 74, 77}},
+		{"Am", Intervals{69, 72, 76}},
+		{"Am/C", Intervals{60, 69, 76}},
+	}
+	for _, tt := range tests {
+		notes, err := ParseChordSymbol(tt.symbol)
+		if err != nil {
+			t.Errorf("ParseChordSymbol(%q): %v", tt.symbol, err)
+			continue
+		}
+		if !samePitchClasses(pitchClasses(notes, 0), pitchClasses(tt.notes, 0)) {
+			t.Errorf("ParseChordSymbol(%q) = %v, want the notes of %v", tt.symbol, notes, tt.notes)
+		}
+		if s := ChordSymbol(tt.notes); s != tt.symbol {
+			t.Errorf("ChordSymbol(%v) = %q, want %q", tt.notes, s, tt.symbol)
+		}
+	}
+}
+
+func TestNumerals(t *testing.T) {
+	c := Key{Tonic: 60}
+	tests := []struct {
+		numeral string
+		key     Key
+		notes   Intervals // notes are relative to the tonic
+	}{
+		{"ii7", c, Intervals{2, 5, 9, 12}},
+		{"V7/V", c, Intervals{2, 6, 9, 12}},
+		{"bVI", c, Intervals{8, 12, 15}},
+		{"bIII", c.Parallel(), Intervals{3, 7, 10}},
+		{"viio7", c.Parallel(), Intervals{11, 14, 17, 20}},
+	}
+	for _, tt := range tests {
+		chord, err := ParseNumeral(tt.numeral)
+		if err != nil {
+			t.Errorf("ParseNumeral(%q): %v", tt.numeral, err)
+			continue
+		}
+		if !samePitchClasses(pitchClasses(chord.Notes, 0), pitchClasses(tt.notes, 0)) {
+			t.Errorf("ParseNumeral(%q) = %v, want the notes of %v", tt.numeral, chord.Notes, tt.notes)
+		}
+		if tt.numeral == "V7/V" {
+			continue
+		}
+		if n := tt.key.Numeral(tt.notes.Add(tt.key.Tonic)); n != tt.numeral {
+			t.Errorf("Numeral(%v) in %v = %q, want %q", tt.notes, tt.key, n, tt.numeral)
+		}
+	}
+}
+
+// subset returns whether the pitch classes of a are among those of b.
+func subset(a map[float64]bool, b map[float64]bool) bool {
+	for pc := range a {
+		if !b[pc] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestChordNamesAreNumerals(t *testing.T) {
+	// chords that leave out notes of their numeral
+	omitted := map[string]bool{"V13": true}
+	for _, s := range styles {
+		for _, table := range []Table{s.Major, s.Minor} {
+			for _, c := range table.Chords {
+				chord, err := ParseNumeral(c.Name)
+				if err != nil {
+					t.Errorf("style %s: %v", s.Name, err)
+					continue
+				}
+				want, got := pitchClasses(chord.Notes, 0), pitchClasses(c.Notes, 0)
+				if !samePitchClasses(want, got) && !(omitted[c.Name] && subset(got, want)) {
+					t.Errorf("style %s: %s has notes %v, but the numeral has %v", s.Name, c.Name, c.Notes, chord.Notes)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,499 @@
+package harmony
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Modulation is a change of key.
+type Modulation string
+
+const (
+	NoModulation         Modulation = ""
+	ModulateUp           Modulation = "up"            // ModulateUp moves the tonic up a fifth
+	ModulateDown         Modulation = "down"          // ModulateDown moves the tonic down a fifth
+	ModulateRelative     Modulation = "relative"      // ModulateRelative keeps the notes and changes the mode
+	ModulateParallel     Modulation = "parallel"      // ModulateParallel keeps the tonic and changes the mode
+	ModulateUpRelative   Modulation = "up relative"   // ModulateUpRelative moves to the relative key of the key a fifth up
+	ModulateDownRelative Modulation = "down relative" // ModulateDownRelative moves to the relative key of the key a fifth down
+)
+
+var modulations = []Modulation{
+	ModulateUp,
+	ModulateDown,
+	ModulateRelative,
+	ModulateParallel,
+	ModulateUpRelative,
+	ModulateDownRelative,
+}
+
+func (m Modulation) valid() bool {
+	for _, n := range modulations {
+		if m == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Key returns the key that the modulation moves k to.
+func (m Modulation) Key(k Key) Key {
+	switch m {
+	case ModulateUp:
+		return k.Transpose(7)
+	case ModulateDown:
+		return k.Transpose(-7)
+	case ModulateRelative:
+		return k.Relative()
+	case ModulateParallel:
+		return k.Parallel()
+	case ModulateUpRelative:
+		return k.Transpose(7).Relative()
+	case ModulateDownRelative:
+		return k.Transpose(-7).Relative()
+	}
+	return k
+}
+
+// Step is a chord of a progression.
+type Step struct {
+	Time       int64 // Time is when the chord starts, in samples
+	Duration   int64
+	Key        Key
+	Function   HarmonicFunction
+	Chord      Chord
+	Notes      Intervals  // Notes are the voiced notes of the chord
+	Modulation Modulation // Modulation is a change of key at the chord
+	Voicing    Voicing    // Voicing explains the choice of Notes before any detune
+}
+
+// Progression is a timeline of chords.
+type Progression struct {
+	Key    Key // Key is the key at the start of the progression
+	Length int // Length is the number of chords of each repetition
+	Steps  []Step
+}
+
+// DefaultChordDuration is the duration of each chord of a generator, in
+// samples.
+const DefaultChordDuration = 96000
+
+// modulationChance is one over the chance to modulate after the first
+// progression following a modulation.
+const modulationChance = 2
+
+// Generator writes progressions that each continue the previous one.
+type Generator struct {
+	Key           Key
+	Style         *Style
+	ChordDuration int64
+	// Detune shifts every other chord of a progression by a fraction of a
+	// semitone.
+	Detune float64
+
+	last     []string // last is the names of the chords of the previous progression
+	modulate int
+	tries    int // tries is the number of chords the search may still voice
+
+	prevName  string // prevName is the previous chord, empty after a change of mode
+	prevChord Intervals
+}
+
+// NewGenerator returns a generator that starts in a key after its
+// dominant.
+func NewGenerator(key Key, style *Style) *Generator {
+	return &Generator{
+		Key:           key,
+		Style:         style,
+		ChordDuration: DefaultChordDuration,
+		Detune:        0.5,
+		modulate:      modulationChance,
+		prevName:      DominantSeventh.Name,
+		prevChord:     DominantSeventh.Notes.Add(key.Tonic - 12),
+	}
+}
+
+// choice is a voiced chord.
+type choice struct {
+	Chord   Chord
+	Notes   Intervals
+	Voicing Voicing
+}
+
+// voice returns a chord in a key voiced by the style after the previous
+// chord.
+func (g *Generator) voice(c Chord, k Key, prevName string, prevNotes Intervals, required []float64) choice {
+	v := g.Style.Voicing.Voice(prevNotes, c.In(k), g.tendencies(prevName, prevNotes), required)
+	return choice{Chord: c, Notes: v.Notes, Voicing: v}
+}
+
+// tendencies returns the leading tone of the key if the previous chord is
+// a dominant that has it, and the seventh of the previous chord.
+func (g *Generator) tendencies(prevName string, prevNotes Intervals) Tendencies {
+	var t Tendencies
+	c, ok := g.Style.table(g.Key).chord(prevName)
+	if !ok {
+		return t
+	}
+	prevNotes = undetuned(prevNotes)
+	if leading := g.Key.Tonic - 1; c.Function == Dominant && hasPitchClass(prevNotes, leading) {
+		t.Leading = Intervals{leading}
+	}
+	if root, q, ok := identify(c.Notes, c.Root()); ok {
+		if s, ok := q.seventh(); ok && hasPitchClass(prevNotes, g.Key.Tonic+root+s) {
+			t.Sevenths = Intervals{g.Key.Tonic + root + s}
+		}
+	}
+	return t
+}
+
+// candidates returns the chords that can follow a chord in a random order
+// weighted by the table.
+func candidates(t *Table, prev string) []Chord {
+	weights, ok := t.Transitions[prev]
+	if prev == "" || !ok {
+		weights = t.Start
+	}
+	if len(weights) == 0 {
+		weights = make(map[string]float64)
+		for _, c := range t.Chords {
+			weights[c.Name] = 1
+		}
+	}
+
+	// order by u^(1/w), which samples without replacement by weight
+	type keyed struct {
+		c   Chord
+		key float64
+	}
+	var ks []keyed
+	for _, c := range t.Chords {
+		if w := weights[c.Name]; w > 0 {
+			ks = append(ks, keyed{c, math.Pow(rand.Float64(), 1/w)})
+		}
+	}
+	sort.Slice(ks, func(i, j int) bool { return ks[i].key > ks[j].key })
+	cs := make([]Chord, len(ks))
+	for i, k := range ks {
+		cs[i] = k.c
+	}
+	return cs
+}
+
+// resolution returns the note of the scale closest to the first note of
+// a chord outside of the scale, or zero. Detuned notes count as the
+// nearest semitone.
+func resolution(scale Intervals, chord Intervals) float64 {
+	var chromaticNote float64
+	for i := range chord {
+		n := math.Round(chord[i])
+		found := false
+		for j := range scale {
+			if n == scale[j] {
+				found = true
+				break
+			} else if n < scale[j] {
+				break
+			}
+		}
+		if !found {
+			chromaticNote = n
+			break
+		}
+	}
+	if chromaticNote == 0 {
+		return 0
+	}
+
+	r := float64(0)
+	for i := len(scale) - 1; i >= 0; i-- {
+		if r == 0 ||
+			math.Abs(scale[i]-chromaticNote) < math.Abs(r-chromaticNote) {
+			r = scale[i]
+		}
+	}
+	return r
+}
+
+func contains(notes Intervals, n float64) bool {
+	for _, m := range notes {
+		if m == n {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed returns whether a chord can be at position i of a progression of
+// length chords after cs.
+func (g *Generator) allowed(rules Constraints, cs []choice, c choice, length int) bool {
+	i := len(cs)
+	if rules.Distinct {
+		for _, d := range cs {
+			if d.Chord.Name == c.Chord.Name {
+				return false
+			}
+		}
+	}
+
+	switch rules.Cadence {
+	case HalfCadence, AuthenticCadence, DeceptiveCadence:
+		if i == length-1 && c.Chord.Function != Dominant {
+			return false
+		}
+	case PlagalCadence:
+		if i == length-1 && c.Chord.Function != Subdominant {
+			return false
+		}
+	}
+	switch rules.Cadence {
+	case AuthenticCadence, PlagalCadence:
+		if i == 0 && c.Chord.Function != Tonic {
+			return false
+		}
+	case DeceptiveCadence:
+		if i == 0 && c.Chord.Function == Tonic {
+			return false
+		}
+	}
+
+	if rules.AvoidRepeat && i == length-1 && len(g.last) == length {
+		same := g.last[i] == c.Chord.Name
+		for j := range cs {
+			same = same && g.last[j] == cs[j].Chord.Name
+		}
+		if same {
+			return false
+		}
+	}
+	return true
+}
+
+// scale returns the scale that the notes of a chord of the table resolve
+// to.
+func (g *Generator) scale(t *Table, name string) Intervals {
+	if len(t.Scale) > 0 {
+		return Intervals(t.Scale).Add(g.Key.Tonic).Expand()
+	}
+	c, _ := t.chord(name)
+	return g.Key.Scale(c, false)
+}
+
+// search extends cs to length chords that follow the rules, trying the
+// more likely chords first.
+func (g *Generator) search(t *Table, rules Constraints, cs []choice, prevName string, prevNotes Intervals, length int) []choice {
+	if len(cs) == length {
+		return cs
+	}
+
+	var required []float64
+	if rules.Resolve {
+		if r := resolution(g.scale(t, prevName), prevNotes); r != 0 {
+			required = append(required, r)
+		}
+	}
+
+	for _, c := range candidates(t, prevName) {
+		if g.tries <= 0 {
+			return nil
+		}
+		g.tries--
+		next := g.voice(c, g.Key, prevName, prevNotes, required)
+		if len(required) > 0 && !contains(next.Notes, required[0]) {
+			continue
+		}
+		if !g.allowed(rules, cs, next, length) {
+			continue
+		}
+		if r := g.search(t, rules, append(cs, next), c.Name, next.Notes, length); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// searchLimit is the number of chords that a search voices before it
+// gives up on its constraints.
+const searchLimit = 1000
+
+// relaxed returns the constraints to try in order, dropping one more
+// constraint each time.
+func relaxed(c Constraints) []Constraints {
+	cs := []Constraints{c}
+	c.Distinct = false
+	cs = append(cs, c)
+	c.Resolve = false
+	cs = append(cs, c)
+	c.AvoidRepeat = false
+	cs = append(cs, c)
+	c.Cadence = AnyCadence
+	return append(cs, c)
+}
+
+// choose returns length chords following the previous chord. The
+// constraints of the style are dropped one by one until a progression
+// follows them.
+func (g *Generator) choose(length int) []choice {
+	t := g.Style.table(g.Key)
+	if len(t.Chords) == 0 {
+		return nil
+	}
+	var cs []choice
+	for _, rules := range relaxed(g.Style.Constraints) {
+		g.tries = searchLimit
+		if cs = g.search(t, rules, nil, g.prevName, g.prevChord, length); cs != nil {
+			break
+		}
+	}
+	for len(cs) < length {
+		// a chord without transitions ends the search
+		c := t.Chords[rand.Intn(len(t.Chords))]
+		cs = append(cs, g.voice(c, g.Key, g.prevName, g.prevChord, nil))
+	}
+	for i := 1; i < len(cs); i += 2 {
+		cs[i].Notes = cs[i].Notes.Add(g.Detune)
+	}
+	return cs
+}
+
+func in(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sameChord returns whether two chords have the same pitch classes.
+func sameChord(a Intervals, b Intervals) bool {
+	pcs := func(notes Intervals) map[float64]bool {
+		m := make(map[float64]bool)
+		for _, n := range notes {
+			m[math.Mod(math.Mod(n, 12)+12, 12)] = true
+		}
+		return m
+	}
+	pa, pb := pcs(a), pcs(b)
+	if len(pa) != len(pb) {
+		return false
+	}
+	for n := range pa {
+		if !pb[n] {
+			return false
+		}
+	}
+	return true
+}
+
+// pivot returns the chord of the table of a new key that best leads from
+// the previous chord, voiced: either a chord of both keys or a dominant
+// of the new key.
+func (g *Generator) pivot(from *Table, to Key, prev choice) (choice, bool) {
+	t := g.Style.table(to)
+	var best choice
+	found := false
+	for _, c := range t.Chords {
+		common := false
+		for _, d := range from.Chords {
+			if sameChord(c.In(to), d.In(g.Key)) {
+				common = true
+				break
+			}
+		}
+		if !common && c.Function != Dominant {
+			continue
+		}
+		v := g.voice(c, to, prev.Chord.Name, prev.Notes, nil)
+		if !found || v.Voicing.Cost < best.Voicing.Cost {
+			best, found = v, true
+		}
+	}
+	return best, found
+}
+
+// modulateKey may change the key of the generator after the penultimate
+// chord of a progression, and returns the key change and the pivot chord
+// that replaces the last chord.
+func (g *Generator) modulateKey(penultimate choice) (Modulation, choice) {
+	t := g.Style.table(g.Key)
+	var ms []Modulation
+	for _, m := range modulations {
+		if in(t.Modulations[m], penultimate.Chord.Name) {
+			ms = append(ms, m)
+		}
+	}
+	if len(ms) == 0 || rand.Intn(g.modulate) != 0 {
+		return NoModulation, choice{}
+	}
+
+	m := ms[rand.Intn(len(ms))]
+	to := m.Key(g.Key)
+	p, ok := g.pivot(t, to, penultimate)
+	if !ok {
+		return NoModulation, choice{}
+	}
+	g.Key = to
+	g.modulate = modulationChance
+	return m, p
+}
+
+// Next returns a progression of length chords repeated reps times. The
+// last chord may change the key for the next progression. The progression
+// has no steps unless reps and length are positive.
+func (g *Generator) Next(reps int, length int) Progression {
+	if reps < 1 || length < 1 {
+		return Progression{Key: g.Key, Length: length}
+	}
+	cc := g.choose(length)
+	if len(cc) == 0 {
+		return Progression{Key: g.Key, Length: length}
+	}
+
+	g.last = g.last[:0]
+	for _, c := range cc {
+		g.last = append(g.last, c.Chord.Name)
+	}
+	prevName := cc[len(cc)-1].Chord.Name
+	prevChord := cc[len(cc)-1].Notes
+
+	p := Progression{Key: g.Key, Length: length}
+	for i := 0; i < reps; i++ {
+		for j := 0; j < len(cc); j++ {
+			s := Step{
+				Time:     int64(i*len(cc)+j) * g.ChordDuration,
+				Duration: g.ChordDuration,
+				Key:      g.Key,
+				Function: cc[j].Chord.Function,
+				Chord:    cc[j].Chord,
+				Notes:    cc[j].Notes,
+				Voicing:  cc[j].Voicing,
+			}
+
+			if i == reps-1 && j == len(cc)-1 && j > 0 {
+				m, p := g.modulateKey(cc[j-1])
+				if m != NoModulation {
+					s.Modulation = m
+					s.Key = g.Key
+					s.Chord = p.Chord
+					s.Notes = p.Notes
+					s.Voicing = p.Voicing
+					s.Function = p.Chord.Function
+					prevName = p.Chord.Name
+					prevChord = p.Notes
+				}
+			}
+
+			p.Steps = append(p.Steps, s)
+		}
+	}
+
+	if g.modulate > 1 {
+		g.modulate--
+	}
+
+	g.prevName = prevName
+	g.prevChord = prevChord
+	return p
+}
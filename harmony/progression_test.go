@@ -0,0 +1,59 @@
+package harmony
+
+import "testing"
+
+func TestTendencies(t *testing.T) {
+	style := &Style{
+		Major: Table{Chords: []Chord{c_IV7, c_V7, c_I}},
+		Minor: Table{Chords: []Chord{c_v7, c_III_7, c_VI7, c_vii_7}},
+	}
+	c, a := Key{Tonic: 60}, Key{Tonic: 69, Minor: true}
+	tests := []struct {
+		key      Key
+		chord    Chord
+		leading  Intervals
+		sevenths Intervals
+	}{
+		{c, c_IV7, nil, Intervals{64}},
+		{c, c_V7, Intervals{59}, Intervals{65}},
+		{c, c_I, nil, nil},
+		{a, c_v7, nil, Intervals{74}},
+		{a, c_III_7, nil, Intervals{71}},
+		{a, c_VI7, nil, Intervals{76}},
+		{a, c_vii_7, nil, Intervals{77}},
+	}
+	for _, tt := range tests {
+		g := &Generator{Key: tt.key, Style: style}
+		got := g.tendencies(tt.chord.Name, tt.chord.In(tt.key))
+		if !samePitchClasses(pitchClasses(got.Leading, 0), pitchClasses(tt.leading, 0)) ||
+			!samePitchClasses(pitchClasses(got.Sevenths, 0), pitchClasses(tt.sevenths, 0)) {
+			t.Errorf("tendencies of %s in %v = %v, want leading %v and sevenths %v", tt.chord.Name, tt.key, got, tt.leading, tt.sevenths)
+		}
+	}
+}
+
+func TestNextLength(t *testing.T) {
+	g := NewGenerator(Key{Tonic: 60}, Classic)
+	for _, tt := range []struct{ reps, length int }{{2, 0}, {0, 4}, {-1, -1}} {
+		if p := g.Next(tt.reps, tt.length); len(p.Steps) != 0 {
+			t.Errorf("Next(%d, %d) has %d steps", tt.reps, tt.length, len(p.Steps))
+		}
+	}
+	for _, s := range styles {
+		g := NewGenerator(Key{Tonic: 60}, s)
+		if p := g.Next(1, 40); len(p.Steps) != 40 {
+			t.Errorf("style %s: Next(1, 40) has %d steps", s.Name, len(p.Steps))
+		}
+	}
+}
+
+func TestEmptyTable(t *testing.T) {
+	s := &Style{Name: "major", Major: Pop.Major, Voicing: DefaultVoicer}
+	if s.Validate() == nil {
+		t.Error("a style without minor chords is valid")
+	}
+	g := NewGenerator(Key{Tonic: 60, Minor: true}, s)
+	if p := g.Next(1, 4); len(p.Steps) != 0 {
+		t.Errorf("a style without minor chords has %d steps in minor", len(p.Steps))
+	}
+}
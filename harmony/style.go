@@ -0,0 +1,440 @@
+package harmony
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Table is the chords of a mode, and how likely each chord is to follow
+// another.
+type Table struct {
+	// Scale is the scale of the mode, the scale of the key when empty. Notes of
+	// a chord outside of the scale resolve in the next chord.
+	Scale  Scale
+	Chords []Chord
+	// Transitions weighs the chords that can follow a chord, by name. A
+	// chord without transitions can be followed by any chord.
+	Transitions map[string]map[string]float64
+	// Start weighs the first chords after a chord that is not in the
+	// table.
+	Start map[string]float64
+	// Modulations names the chords after which a progression can end
+	// with a pivot chord into another key, by modulation.
+	Modulations map[Modulation][]string
+}
+
+// Cadence is how a progression ends.
+type Cadence string
+
+const (
+	AnyCadence       Cadence = ""
+	HalfCadence      Cadence = "half"      // HalfCadence ends on a dominant
+	AuthenticCadence Cadence = "authentic" // AuthenticCadence ends on a dominant and starts on a tonic
+	PlagalCadence    Cadence = "plagal"    // PlagalCadence ends on a subdominant and starts on a tonic
+	DeceptiveCadence Cadence = "deceptive" // DeceptiveCadence ends on a dominant and starts on another chord
+)
+
+// Constraints are rules that every progression of a style follows when
+// possible.
+type Constraints struct {
+	Cadence Cadence
+	// AvoidRepeat keeps a progression from repeating the chords of the
+	// previous one.
+	AvoidRepeat bool
+	// Distinct keeps a chord from appearing twice in a progression.
+	Distinct bool
+	// Resolve moves notes outside of the scale to the closest note of the
+	// scale in the next chord.
+	Resolve bool
+}
+
+// Style is a way of choosing chords in major and minor keys.
+type Style struct {
+	Name        string
+	Major       Table
+	Minor       Table
+	Constraints Constraints
+	Bass        BassStyle
+	// Voicing is how the chords are voiced. Styles start from
+	// DefaultVoicer, so that a zero weight turns a rule off.
+	Voicing Voicer
+}
+
+func (t *Table) chord(name string) (Chord, bool) {
+	for _, c := range t.Chords {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Chord{}, false
+}
+
+func (t *Table) validate() error {
+	names := make(map[string]bool)
+	for _, c := range t.Chords {
+		if c.Name == "" || names[c.Name] {
+			return fmt.Errorf("chord names must be unique and not empty: %q", c.Name)
+		}
+		if len(c.Notes) == 0 {
+			return fmt.Errorf("chord %s has no notes", c.Name)
+		}
+		names[c.Name] = true
+	}
+	check := func(weights map[string]float64) error {
+		for name, w := range weights {
+			if !names[name] {
+				return fmt.Errorf("unknown chord %q", name)
+			}
+			if w < 0 {
+				return fmt.Errorf("chord %s has negative weight", name)
+			}
+		}
+		return nil
+	}
+	for from, to := range t.Transitions {
+		if !names[from] {
+			return fmt.Errorf("unknown chord %q", from)
+		}
+		if err := check(to); err != nil {
+			return fmt.Errorf("transitions from %s: %v", from, err)
+		}
+	}
+	if err := check(t.Start); err != nil {
+		return fmt.Errorf("start: %v", err)
+	}
+	for m, chords := range t.Modulations {
+		if !m.valid() {
+			return fmt.Errorf("unknown modulation %q", m)
+		}
+		for _, name := range chords {
+			if !names[name] {
+				return fmt.Errorf("modulation %s: unknown chord %q", m, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if the style refers to chords it does not
+// define.
+func (s *Style) Validate() error {
+	if len(s.Major.Chords) == 0 || len(s.Minor.Chords) == 0 {
+		return fmt.Errorf("style %s needs major and minor chords", s.Name)
+	}
+	if err := s.Major.validate(); err != nil {
+		return fmt.Errorf("style %s: major: %v", s.Name, err)
+	}
+	if err := s.Minor.validate(); err != nil {
+		return fmt.Errorf("style %s: minor: %v", s.Name, err)
+	}
+	switch s.Constraints.Cadence {
+	case AnyCadence, HalfCadence, AuthenticCadence, PlagalCadence, DeceptiveCadence:
+	default:
+		return fmt.Errorf("style %s: unknown cadence %q", s.Name, s.Constraints.Cadence)
+	}
+	if !s.Bass.valid() {
+		return fmt.Errorf("style %s: unknown bass %q", s.Name, s.Bass)
+	}
+	if err := s.Voicing.validate(); err != nil {
+		return fmt.Errorf("style %s: voicing: %v", s.Name, err)
+	}
+	return nil
+}
+
+// table returns the table of the mode of a key.
+func (s *Style) table(k Key) *Table {
+	if k.Minor {
+		return &s.Minor
+	}
+	return &s.Major
+}
+
+// LoadStyle reads a style from a JSON file.
+func LoadStyle(filename string) (*Style, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := Style{Voicing: DefaultVoicer}
+	if err := json.NewDecoder(f).Decode(&s); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return &s, nil
+}
+
+// functionalTable returns a table in which chords follow each other by
+// function, with each following function equally likely.
+func functionalTable(k Key, modulations map[Modulation][]string) Table {
+	t := Table{
+		Transitions: make(map[string]map[string]float64),
+		Start:       make(map[string]float64),
+		Modulations: modulations,
+	}
+	byFunction := make(map[HarmonicFunction][]Chord)
+	for f := Tonic; f <= Other; f++ {
+		for _, c := range append(append([]Chord(nil), k.Chords(f)...), k.Substitutes(f)...) {
+			if _, ok := t.chord(c.Name); ok {
+				continue
+			}
+			t.Chords = append(t.Chords, c)
+			byFunction[c.Function] = append(byFunction[c.Function], c)
+		}
+	}
+	for _, c := range t.Chords {
+		following := c.Function.Following()
+		w := make(map[string]float64)
+		for _, f := range following {
+			for _, d := range byFunction[f] {
+				w[d.Name] = 1 / float64(len(following)*len(byFunction[f]))
+			}
+		}
+		t.Transitions[c.Name] = w
+	}
+	for _, c := range byFunction[Tonic] {
+		t.Start[c.Name] = 1
+	}
+	return t
+}
+
+// Classic is the functional harmony of AutoChords.
+var Classic = &Style{
+	Name: "classic",
+	Major: functionalTable(Key{}, map[Modulation][]string{
+		ModulateDown:       {"ii7", "IVmaj7"},
+		ModulateUp:         {"I6"},
+		ModulateParallel:   {"V7sus4"},
+		ModulateUpRelative: {"iii7"},
+	}),
+	Minor: functionalTable(Key{Minor: true}, map[Modulation][]string{
+		ModulateDown:         {"iv7"},
+		ModulateRelative:     {"bVII7"},
+		ModulateParallel:     {"v7"},
+		ModulateDownRelative: {"bVImaj7"},
+	}),
+	Constraints: Constraints{
+		AvoidRepeat: true,
+		Distinct:    true,
+		Resolve:     true,
+	},
+	Bass:    RootFifthBass,
+	Voicing: DefaultVoicer,
+}
+
+// Pop is diatonic triads, mostly I, IV, V and vi.
+var Pop = &Style{
+	Name: "pop",
+	Major: Table{
+		Chords: []Chord{
+			{"I", Tonic, Intervals{0, 4, 7}},
+			{"ii", Subdominant, Intervals{2, 5, 9}},
+			{"iii", Other, Intervals{4, 7, 11}},
+			{"IV", Subdominant, Intervals{5, 9, 12}},
+			{"V", Dominant, Intervals{7, 11, 14}},
+			{"vi", Other, Intervals{9, 12, 16}},
+		},
+		Transitions: map[string]map[string]float64{
+			"I":   {"ii": 1, "IV": 3, "V": 2, "vi": 3},
+			"ii":  {"IV": 1, "V": 3},
+			"iii": {"IV": 2, "vi": 2},
+			"IV":  {"I": 2, "ii": 1, "V": 3, "vi": 1},
+			"V":   {"I": 3, "IV": 1, "vi": 2},
+			"vi":  {"ii": 1, "iii": 1, "IV": 3, "V": 1},
+		},
+		Start: map[string]float64{"I": 3, "vi": 1},
+		Modulations: map[Modulation][]string{
+			ModulateDown:     {"ii"},
+			ModulateRelative: {"vi"},
+		},
+	},
+	Minor: Table{
+		Scale: NaturalMinor,
+		Chords: []Chord{
+			{"i", Tonic, Intervals{0, 3, 7}},
+			{"bIII", Other, Intervals{3, 7, 10}},
+			{"iv", Subdominant, Intervals{5, 8, 12}},
+			{"v", Dominant, Intervals{7, 10, 14}},
+			{"bVI", Subdominant, Intervals{8, 12, 15}},
+			{"bVII", Dominant, Intervals{10, 14, 17}},
+		},
+		Transitions: map[string]map[string]float64{
+			"i":    {"bIII": 1, "iv": 2, "bVI": 3, "bVII": 2},
+			"bIII": {"iv": 1, "bVI": 2, "bVII": 1},
+			"iv":   {"i": 2, "v": 1, "bVII": 2},
+			"v":    {"i": 2, "bVI": 1},
+			"bVI":  {"bIII": 1, "iv": 1, "bVII": 3},
+			"bVII": {"i": 2, "bIII": 2, "bVI": 1},
+		},
+		Start: map[string]float64{"i": 3, "bVI": 1},
+		Modulations: map[Modulation][]string{
+			ModulateRelative: {"iv"},
+			ModulateDown:     {"bVI"},
+		},
+	},
+	Constraints: Constraints{
+		Cadence:     HalfCadence,
+		AvoidRepeat: true,
+		Resolve:     true,
+	},
+	Bass:    SyncopatedBass,
+	Voicing: DefaultVoicer,
+}
+
+// Jazz is ii-V-I progressions with extended chords, secondary dominants
+// and tritone substitutions.
+var Jazz = &Style{
+	Name: "jazz",
+	Major: Table{
+		Chords: []Chord{
+			{"Imaj7", Tonic, Intervals{0, 4, 7, 11}},
+			{"I6/9", Tonic, Intervals{0, 2, 4, 7, 9}},
+			{"ii9", Subdominant, Intervals{2, 5, 9, 12, 16}},
+			{"iii7", Other, Intervals{4, 7, 11, 14}},
+			{"VI7", Other, Intervals{9, 13, 16, 19}},
+			{"vi9", Other, Intervals{9, 12, 16, 19, 23}},
+			{"V13", Dominant, Intervals{7, 11, 17, 21, 28}},
+			{"V7b9", Dominant, Intervals{7, 11, 14, 17, 20}},
+			{"bII7", Dominant, Intervals{1, 5, 8, 11}},
+		},
+		Transitions: map[string]map[string]float64{
+			"Imaj7": {"ii9": 2, "iii7": 1, "VI7": 2, "vi9": 2},
+			"I6/9":  {"ii9": 2, "VI7": 2, "vi9": 1},
+			"ii9":   {"V13": 3, "V7b9": 2, "bII7": 2},
+			"iii7":  {"VI7": 3, "vi9": 1},
+			"VI7":   {"ii9": 3},
+			"vi9":   {"ii9": 3, "VI7": 1},
+			"V13":   {"Imaj7": 3, "I6/9": 2, "vi9": 1},
+			"V7b9":  {"Imaj7": 2, "I6/9": 1},
+			"bII7":  {"Imaj7": 2, "I6/9": 2},
+		},
+		Start: map[string]float64{"Imaj7": 2, "I6/9": 1},
+		Modulations: map[Modulation][]string{
+			ModulateDown:     {"ii9"},
+			ModulateParallel: {"V7b9"},
+		},
+	},
+	Minor: Table{
+		Scale: HarmonicMinor,
+		Chords: []Chord{
+			{"im6", Tonic, Intervals{0, 3, 7, 9}},
+			{"im(maj7)", Tonic, Intervals{0, 3, 7, 11}},
+			{"iiø7", Subdominant, Intervals{2, 5, 8, 12}},
+			{"ivm9", Subdominant, Intervals{5, 8, 12, 15, 19}},
+			{"bVImaj7", Other, Intervals{8, 12, 15, 19}},
+			{"V7b9", Dominant, Intervals{7, 11, 14, 17, 20}},
+			{"bII7", Dominant, Intervals{1, 5, 8, 11}},
+		},
+		Transitions: map[string]map[string]float64{
+			"im6":      {"iiø7": 2, "ivm9": 1, "bVImaj7": 1},
+			"im(maj7)": {"iiø7": 2, "ivm9": 2, "bVImaj7": 1},
+			"iiø7":     {"V7b9": 3, "bII7": 1},
+			"ivm9":     {"iiø7": 1, "V7b9": 2},
+			"bVImaj7":  {"iiø7": 2, "bII7": 1},
+			"V7b9":     {"im6": 2, "im(maj7)": 1, "bVImaj7": 1},
+			"bII7":     {"im6": 1, "im(maj7)": 1},
+		},
+		Start: map[string]float64{"im6": 1, "im(maj7)": 1},
+		Modulations: map[Modulation][]string{
+			ModulateDown:     {"ivm9"},
+			ModulateParallel: {"V7b9"},
+		},
+	},
+	Constraints: Constraints{
+		AvoidRepeat: true,
+		Resolve:     true,
+	},
+	Bass:    WalkingBass,
+	Voicing: DefaultVoicer.WithSpread(Drop2Voicing),
+}
+
+// Modal is mixolydian harmony for major keys and dorian for minor keys,
+// without leading tones.
+var Modal = &Style{
+	Name: "modal",
+	Major: Table{
+		Scale: Scale{0, 2, 4, 5, 7, 9, 10},
+		Chords: []Chord{
+			{"I", Tonic, Intervals{0, 4, 7}},
+			{"Isus4", Tonic, Intervals{0, 5, 7}},
+			{"IV", Subdominant, Intervals{5, 9, 12}},
+			{"v7", Dominant, Intervals{7, 10, 14, 17}},
+			{"bVII", Dominant, Intervals{10, 14, 17}},
+			{"ii7", Other, Intervals{2, 5, 9, 12}},
+		},
+		Transitions: map[string]map[string]float64{
+			"I":     {"Isus4": 1, "IV": 2, "v7": 1, "bVII": 3},
+			"Isus4": {"I": 2, "bVII": 1},
+			"IV":    {"I": 2, "bVII": 1, "ii7": 1},
+			"v7":    {"IV": 1, "ii7": 1, "I": 1},
+			"bVII":  {"I": 3, "IV": 2},
+			"ii7":   {"v7": 1, "bVII": 1, "I": 1},
+		},
+		Start: map[string]float64{"I": 1},
+		Modulations: map[Modulation][]string{
+			ModulateDown:     {"IV"},
+			ModulateUp:       {"v7"},
+			ModulateParallel: {"Isus4"},
+		},
+	},
+	Minor: Table{
+		Scale: Scale{0, 2, 3, 5, 7, 9, 10},
+		Chords: []Chord{
+			{"i7", Tonic, Intervals{0, 3, 7, 10}},
+			{"ii7", Other, Intervals{2, 5, 9, 12}},
+			{"bIIImaj7", Other, Intervals{3, 7, 10, 14}},
+			{"IV7", Subdominant, Intervals{5, 9, 12, 15}},
+			{"v7", Dominant, Intervals{7, 10, 14, 17}},
+			{"bVII", Dominant, Intervals{10, 14, 17}},
+		},
+		Transitions: map[string]map[string]float64{
+			"i7":       {"ii7": 1, "bIIImaj7": 1, "IV7": 3, "bVII": 2},
+			"ii7":      {"i7": 1, "bIIImaj7": 2},
+			"bIIImaj7": {"IV7": 2, "ii7": 1},
+			"IV7":      {"i7": 3, "v7": 1, "bVII": 1},
+			"v7":       {"i7": 2, "IV7": 1},
+			"bVII":     {"i7": 2, "IV7": 2},
+		},
+		Start: map[string]float64{"i7": 1},
+		Modulations: map[Modulation][]string{
+			ModulateDown:     {"IV7"},
+			ModulateParallel: {"i7"},
+		},
+	},
+	Constraints: Constraints{
+		AvoidRepeat: true,
+	},
+	Bass:    PedalBass,
+	Voicing: DefaultVoicer.WithSpread(OpenVoicing),
+}
+
+var styles = map[string]*Style{
+	Classic.Name: Classic,
+	Pop.Name:     Pop,
+	Jazz.Name:    Jazz,
+	Modal.Name:   Modal,
+}
+
+// StyleNames returns the names of the built in styles in order.
+func StyleNames() []string {
+	var names []string
+	for name := range styles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NamedStyle returns a built in style.
+func NamedStyle(name string) (*Style, error) {
+	s, ok := styles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown style %q", name)
+	}
+	return s, nil
+}
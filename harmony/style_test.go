@@ -0,0 +1,22 @@
+package harmony
+
+import "testing"
+
+func TestStyles(t *testing.T) {
+	for name, s := range styles {
+		if err := s.Validate(); err != nil {
+			t.Errorf("style %s: %v", name, err)
+			continue
+		}
+		for _, key := range []Key{{Tonic: 60}, {Tonic: 69, Minor: true}} {
+			g := NewGenerator(key, s)
+			for i := 0; i < 8; i++ {
+				for _, step := range g.Next(1, 4).Steps {
+					if len(step.Notes) != s.Voicing.Voices {
+						t.Errorf("style %s: %s in %v has notes %v, want %d", name, step.Chord.Name, step.Key, step.Notes, s.Voicing.Voices)
+					}
+				}
+			}
+		}
+	}
+}
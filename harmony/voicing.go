@@ -0,0 +1,318 @@
+package harmony
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// VoicingSize is the number of notes of a voiced chord.
+const VoicingSize = 4
+
+// Spread is how far apart the notes of a voicing are.
+type Spread string
+
+const (
+	ClosedVoicing Spread = ""       // ClosedVoicing keeps consecutive chord tones together
+	OpenVoicing   Spread = "open"   // OpenVoicing raises every other note of a closed voicing an octave
+	Drop2Voicing  Spread = "drop-2" // Drop2Voicing lowers the second highest note of a closed voicing an octave
+	Drop3Voicing  Spread = "drop-3" // Drop3Voicing lowers the third highest note of a closed voicing an octave
+)
+
+// spread returns a closed voicing spread out, in order.
+func (s Spread) spread(closed Intervals) Intervals {
+	v := append(Intervals(nil), closed...)
+	switch s {
+	case OpenVoicing:
+		for i := 1; i < len(v); i += 2 {
+			v[i] += 12
+		}
+	case Drop2Voicing:
+		if len(v) >= 2 {
+			v[len(v)-2] -= 12
+		}
+	case Drop3Voicing:
+		if len(v) >= 3 {
+			v[len(v)-3] -= 12
+		}
+	}
+	sort.Float64s(v)
+	return v
+}
+
+// Range is the notes that a voice can play.
+type Range struct {
+	Low, High float64
+}
+
+// Weights are the costs of the properties of a voicing. A zero weight
+// turns its rule off.
+type Weights struct {
+	Movement   float64 // Movement is the cost of a semitone of movement of a voice
+	Register   float64 // Register is the cost of a semitone from the center
+	Parallel   float64 // Parallel is the cost of parallel fifths or octaves
+	Resolution float64 // Resolution is the cost of a leading tone or seventh that does not resolve
+	Range      float64 // Range is the cost of a semitone outside of the range of a voice
+	Missing    float64 // Missing is the cost of a required note that is not in the voicing
+}
+
+// Voicer chooses how to voice chords following one another. Voicers
+// start from DefaultVoicer.
+type Voicer struct {
+	Voices  int
+	Spread  Spread
+	Ranges  []Range // Ranges are the ranges of the voices from the lowest, if any
+	Center  float64 // Center is the note that voicings stay near
+	Weights Weights
+}
+
+// DefaultVoicer voices four notes in closed position around A3.
+var DefaultVoicer = Voicer{
+	Voices: VoicingSize,
+	Center: 57,
+	Weights: Weights{
+		Movement:   1,
+		Register:   0.2,
+		Parallel:   8,
+		Resolution: 6,
+		Range:      4,
+		Missing:    100,
+	},
+}
+
+// WithSpread returns the voicer with another spread.
+func (v Voicer) WithSpread(s Spread) Voicer {
+	v.Spread = s
+	return v
+}
+
+func (v Voicer) validate() error {
+	switch v.Spread {
+	case ClosedVoicing, OpenVoicing, Drop2Voicing, Drop3Voicing:
+	default:
+		return fmt.Errorf("unknown spread %q", v.Spread)
+	}
+	if v.Voices < 1 || v.Voices > 8 {
+		return fmt.Errorf("%d voices is not between 1 and 8", v.Voices)
+	}
+	if len(v.Ranges) > 0 && len(v.Ranges) != v.Voices {
+		return fmt.Errorf("%d ranges for %d voices", len(v.Ranges), v.Voices)
+	}
+	for i, r := range v.Ranges {
+		if r.Low > r.High {
+			return fmt.Errorf("range of voice %d is empty", i+1)
+		}
+	}
+	w := v.Weights
+	for _, x := range []float64{w.Movement, w.Register, w.Parallel, w.Resolution, w.Range, w.Missing} {
+		if x < 0 {
+			return fmt.Errorf("weights cannot be negative")
+		}
+	}
+	return nil
+}
+
+// Tendencies are the pitch classes of a voicing that lead to the next
+// chord.
+type Tendencies struct {
+	Leading  Intervals // Leading are the notes that resolve up a semitone
+	Sevenths Intervals // Sevenths are the notes that resolve down a step
+}
+
+// Penalty is a part of the cost of a voicing.
+type Penalty struct {
+	Rule string
+	Cost float64
+}
+
+// Voicing is a voiced chord and the penalties that make up its cost.
+type Voicing struct {
+	Notes     Intervals
+	Cost      float64
+	Penalties []Penalty
+}
+
+// String explains the cost of the voicing.
+func (v Voicing) String() string {
+	var notes, rules []string
+	for _, n := range v.Notes {
+		notes = append(notes, NoteName(n))
+	}
+	for _, p := range v.Penalties {
+		rules = append(rules, fmt.Sprintf("%s (%.1f)", p.Rule, p.Cost))
+	}
+	return fmt.Sprintf("%v cost %.1f: %s", notes, v.Cost, strings.Join(rules, ", "))
+}
+
+// scorer adds up the cost of a voicing. Only the chosen voicing explains
+// its cost, so that the other candidates do not format penalties.
+type scorer struct {
+	Voicing
+	explain bool
+}
+
+// add adds to the cost, with the rule that costs it if the voicing is
+// explained and the rule is not turned off.
+func (s *scorer) add(cost float64, rule func() string) {
+	s.Cost += cost
+	if s.explain && cost != 0 {
+		s.Penalties = append(s.Penalties, Penalty{Rule: rule(), Cost: cost})
+	}
+}
+
+// pitchClass returns the pitch class of a note rounded to a semitone.
+func pitchClass(n float64) float64 {
+	return math.Mod(math.Mod(math.Round(n), 12)+12, 12)
+}
+
+// hasPitchClass returns whether a chord has a note of the pitch class.
+func hasPitchClass(chord Intervals, pc float64) bool {
+	for _, n := range chord {
+		if pitchClass(n) == pitchClass(pc) {
+			return true
+		}
+	}
+	return false
+}
+
+// undetuned returns notes without the fraction of a semitone that they
+// are detuned by.
+func undetuned(notes Intervals) Intervals {
+	if len(notes) == 0 {
+		return notes
+	}
+	return notes.Add(math.Floor(notes[0]) - notes[0])
+}
+
+// closed returns the voicings of a chord with consecutive notes, each
+// doubled with notes within an octave if the chord has fewer notes than
+// the voicer has voices.
+func (v Voicer) closed(chord Intervals) []Intervals {
+	exp := chord.Expand()
+	n := v.Voices
+	if len(chord) < n {
+		n = len(chord)
+	}
+	var vs []Intervals
+	for i := 0; i+n <= len(exp); i++ {
+		vs = append(vs, double(exp[i:i+n], exp, v.Voices-n, 0)...)
+	}
+	return vs
+}
+
+// double returns the voicing with extra notes of exp from index i that
+// are within an octave of it.
+func double(voicing Intervals, exp Intervals, extra int, i int) []Intervals {
+	if extra == 0 {
+		return []Intervals{voicing}
+	}
+	var vs []Intervals
+	for ; i < len(exp); i++ {
+		n := exp[i]
+		if n < voicing[0]-12 || n > voicing[len(voicing)-1]+12 || contains(voicing, n) {
+			continue
+		}
+		d := append(append(Intervals(nil), voicing...), n)
+		sort.Float64s(d)
+		vs = append(vs, double(d, exp, extra-1, i+1)...)
+	}
+	return vs
+}
+
+// Voice returns the voicing of a chord with the least cost after the
+// previous voicing.
+func (v Voicer) Voice(prev Intervals, chord Intervals, t Tendencies, required []float64) Voicing {
+	from := undetuned(prev)
+
+	best, bestCost := chord, math.Inf(1)
+	for _, c := range v.closed(chord) {
+		c = v.Spread.spread(c)
+		if cost := v.voicing(prev, from, c, chord, t, required, false).Cost; cost < bestCost {
+			best, bestCost = c, cost
+		}
+	}
+	return v.voicing(prev, from, best, chord, t, required, true)
+}
+
+// voicing returns the cost of notes after the previous voicing, and the
+// penalties that make it up if explain is set.
+func (v Voicer) voicing(prev Intervals, from Intervals, notes Intervals, chord Intervals, t Tendencies, required []float64, explain bool) Voicing {
+	c := scorer{Voicing: Voicing{Notes: notes}, explain: explain}
+	w := v.Weights
+	positional := len(prev) == len(notes)
+
+	var distance, moves, register float64
+	for j, n := range notes {
+		var move float64
+		if positional {
+			move = prev[j] - n
+		} else if len(prev) > 0 {
+			move = math.Inf(1)
+			for _, p := range prev {
+				if math.Abs(p-n) < math.Abs(move) {
+					move = p - n
+				}
+			}
+		}
+		distance += math.Sqrt(10 + math.Pow(w.Movement*move, 2) + math.Pow(w.Register*(n-v.Center), 2))
+		moves += math.Abs(move)
+		register += math.Abs(n - v.Center)
+	}
+	c.add(distance, func() string {
+		return fmt.Sprintf("moves %g semitones, %.1f from %g on average", moves, register/float64(len(notes)), v.Center)
+	})
+
+	for _, r := range required {
+		if !contains(notes, r) {
+			c.add(w.Missing, func() string { return fmt.Sprintf("misses %g", r) })
+		}
+	}
+
+	for j, n := range notes {
+		if j >= len(v.Ranges) {
+			break
+		}
+		if out := math.Max(v.Ranges[j].Low-n, n-v.Ranges[j].High); out > 0 {
+			c.add(w.Range*out, func() string { return fmt.Sprintf("voice %d is %g out of range", j+1, out) })
+		}
+	}
+
+	if !positional {
+		return c.Voicing
+	}
+	for j, n := range notes {
+		move := math.Round(n - from[j])
+		pc := pitchClass(from[j])
+		if hasPitchClass(t.Leading, pc) && hasPitchClass(chord, pc+1) && move != 1 {
+			c.add(w.Resolution, func() string { return fmt.Sprintf("leading tone of voice %d does not resolve", j+1) })
+		}
+		if hasPitchClass(t.Sevenths, pc) && (hasPitchClass(chord, pc-1) || hasPitchClass(chord, pc-2)) && move != -1 && move != -2 {
+			c.add(w.Resolution, func() string { return fmt.Sprintf("seventh of voice %d does not resolve", j+1) })
+		}
+	}
+	for j := range notes {
+		for k := j + 1; k < len(notes); k++ {
+			before := math.Round(from[k] - from[j])
+			after := math.Round(notes[k] - notes[j])
+			if before != after || (math.Mod(before, 12) != 0 && math.Mod(before, 12) != 7) {
+				continue
+			}
+			if math.Round(notes[j]-from[j]) == 0 {
+				continue
+			}
+			name := "fifths"
+			if math.Mod(before, 12) == 0 {
+				name = "octaves"
+			}
+			c.add(w.Parallel, func() string { return fmt.Sprintf("parallel %s in voices %d and %d", name, j+1, k+1) })
+		}
+	}
+	return c.Voicing
+}
+
+// NearestVoicing returns the notes of a chord closest to the previous
+// voicing, near the middle of the range, and with the required notes.
+func NearestVoicing(prev Intervals, chord Intervals, required []float64) Intervals {
+	return DefaultVoicer.Voice(prev, chord, Tendencies{}, required).Notes
+}
@@ -0,0 +1,136 @@
+package aujo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNoHistory is returned when there is no change to undo or redo.
+var ErrNoHistory = errors.New("no change to undo or redo")
+
+// ErrHistoryChanged is returned when the history changed while a step was
+// being restored.
+var ErrHistoryChanged = errors.New("history changed")
+
+// HistoryStep is a change in a History.
+type HistoryStep struct {
+	Key  string    // Key names what was changed, like "instrument 0"
+	Time time.Time // Time is when the step was last changed
+
+	state []byte
+}
+
+// History keeps the latest states of something for undo and redo. Changes
+// with the same key that follow each other closely are merged into a
+// single step.
+type History struct {
+	mutex  sync.Mutex
+	steps  []HistoryStep
+	pos    int // pos is the index of the current state in steps
+	size   int
+	window time.Duration
+}
+
+// NewHistory returns a history of the initial state that keeps up to size
+// steps, and merges changes less than window apart.
+func NewHistory(initial []byte, size int, window time.Duration) *History {
+	if size < 2 {
+		size = 2
+	}
+	return &History{
+		steps:  []HistoryStep{{Key: "initial", Time: time.Now(), state: initial}},
+		size:   size,
+		window: window,
+	}
+}
+
+// Add records the state after a change. Steps that were undone are
+// forgotten.
+func (h *History) Add(key string, state []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := time.Now()
+	cur := &h.steps[h.pos]
+	if h.pos > 0 && h.pos == len(h.steps)-1 && cur.Key == key && now.Sub(cur.Time) < h.window {
+		cur.Time = now
+		cur.state = state
+		return
+	}
+
+	h.steps = append(h.steps[:h.pos+1], HistoryStep{Key: key, Time: now, state: state})
+	if len(h.steps) > h.size {
+		h.steps = append(h.steps[:0], h.steps[len(h.steps)-h.size:]...)
+	}
+	h.pos = len(h.steps) - 1
+}
+
+// Peek returns the state d steps from the current one, like -1 for the
+// state to undo to and 1 for the state to redo.
+func (h *History) Peek(d int) ([]byte, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	pos := h.pos + d
+	if pos < 0 || pos >= len(h.steps) {
+		return nil, ErrNoHistory
+	}
+	return h.steps[pos].state, nil
+}
+
+// Move steps d steps after the state from Peek has been applied. It
+// returns ErrHistoryChanged if the state is no longer there.
+func (h *History) Move(d int, state []byte) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	pos := h.pos + d
+	if pos < 0 || pos >= len(h.steps) || !bytes.Equal(h.steps[pos].state, state) {
+		return ErrHistoryChanged
+	}
+	h.pos = pos
+	return nil
+}
+
+// Steps returns the steps of the history, and the index of the current
+// one.
+func (h *History) Steps() ([]HistoryStep, int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	steps := make([]HistoryStep, len(h.steps))
+	for i, s := range h.steps {
+		steps[i] = HistoryStep{Key: s.Key, Time: s.Time}
+	}
+	return steps, h.pos
+}
+
+// Snapshot returns the configuration of the mix. The mix must be locked.
+func (m *Mix) Snapshot() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// Decode decodes a snapshot of the mix, reading the files of its
+// instruments, into a mix that Apply swaps in. The mix need not be locked,
+// so that reading the files does not hold up the audio.
+func (m *Mix) Decode(data []byte) (*Mix, error) {
+	return DecodeMixConfig(data, m.dir)
+}
+
+// Apply replaces the configuration of the mix with that of a decoded one,
+// keeping the notes that are playing. The mix must be locked.
+func (m *Mix) Apply(n *Mix) {
+	m.Level = n.Level
+	m.Instruments = n.Instruments
+	voices := make([]Voice, len(n.Voices))
+	for i := range voices {
+		if i < len(m.Voices) {
+			voices[i] = m.Voices[i]
+		}
+		voices[i].Update(n.Voices[i])
+	}
+	m.Voices = voices
+}
@@ -0,0 +1,87 @@
+package aujo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// historyOp is an add of a state with a key, or an undo or redo when key
+// is empty.
+type historyOp struct {
+	key   string
+	state string
+	d     int
+	err   error
+}
+
+func TestHistory(t *testing.T) {
+	add := func(key string, state string) historyOp { return historyOp{key: key, state: state} }
+	undo, redo := historyOp{d: -1}, historyOp{d: 1}
+	tests := []struct {
+		name   string
+		size   int
+		window time.Duration
+		ops    []historyOp
+		keys   []string
+		state  string
+	}{
+		{"merge", 10, time.Hour, []historyOp{add("a", "1"), add("a", "2")}, []string{"initial", "a"}, "2"},
+		{"no window", 10, 0, []historyOp{add("a", "1"), add("a", "2")}, []string{"initial", "a", "a"}, "2"},
+		{"other key", 10, time.Hour, []historyOp{add("a", "1"), add("b", "2"), add("a", "3")}, []string{"initial", "a", "b", "a"}, "3"},
+		{"size", 3, 0, []historyOp{add("a", "1"), add("b", "2"), add("c", "3")}, []string{"a", "b", "c"}, "3"},
+		{"undo", 10, 0, []historyOp{add("a", "1"), add("b", "2"), undo}, []string{"initial", "a", "b"}, "1"},
+		{"redo", 10, 0, []historyOp{add("a", "1"), add("b", "2"), undo, undo, redo}, []string{"initial", "a", "b"}, "1"},
+		{"forget", 10, 0, []historyOp{add("a", "1"), add("b", "2"), undo, add("c", "3")}, []string{"initial", "a", "c"}, "3"},
+		{"no merge after undo", 10, time.Hour, []historyOp{add("a", "1"), add("b", "2"), undo, add("a", "3")}, []string{"initial", "a", "a"}, "3"},
+		{"no merge with initial", 10, time.Hour, []historyOp{add("initial", "1")}, []string{"initial", "initial"}, "1"},
+		{"nothing to undo", 10, 0, []historyOp{add("a", "1"), undo, {d: -1, err: ErrNoHistory}}, []string{"initial", "a"}, "0"},
+		{"nothing to redo", 10, 0, []historyOp{add("a", "1"), {d: 1, err: ErrNoHistory}}, []string{"initial", "a"}, "1"},
+		{"undo trimmed", 2, 0, []historyOp{add("a", "1"), add("b", "2"), undo, {d: -1, err: ErrNoHistory}}, []string{"a", "b"}, "1"},
+	}
+	for _, tt := range tests {
+		h := NewHistory([]byte("0"), tt.size, tt.window)
+		for i, op := range tt.ops {
+			if op.key != "" {
+				h.Add(op.key, []byte(op.state))
+				continue
+			}
+			state, err := h.Peek(op.d)
+			if err == nil {
+				err = h.Move(op.d, state)
+			}
+			if err != op.err {
+				t.Errorf("%s: op %d: error %v, want %v", tt.name, i, err, op.err)
+			}
+		}
+
+		steps, pos := h.Steps()
+		var keys []string
+		for _, s := range steps {
+			keys = append(keys, s.Key)
+		}
+		if !reflect.DeepEqual(keys, tt.keys) {
+			t.Errorf("%s: steps %v, want %v", tt.name, keys, tt.keys)
+		}
+		if state, err := h.Peek(0); err != nil || string(state) != tt.state {
+			t.Errorf("%s: state at %d is %q, %v, want %q", tt.name, pos, state, err, tt.state)
+		}
+	}
+}
+
+func TestHistoryChanged(t *testing.T) {
+	h := NewHistory([]byte("0"), 10, 0)
+	h.Add("a", []byte("1"))
+	state, err := h.Peek(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another change comes in before the state is applied
+	h.Add("b", []byte("2"))
+	if err := h.Move(-1, state); err != ErrHistoryChanged {
+		t.Errorf("Move after a change: %v, want %v", err, ErrHistoryChanged)
+	}
+	if state, _ := h.Peek(0); string(state) != "2" {
+		t.Errorf("state after a failed move is %q, want %q", state, "2")
+	}
+}
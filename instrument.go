@@ -0,0 +1,241 @@
+package aujo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Instrument generates the sound of the channels of a voice.
+type Instrument interface {
+	// Type is the name used for the instrument in the Type field of the
+	// configuration.
+	Type() string
+
+	// Level returns the envelope level at index samples after the event,
+	// and false when the channel has finished sounding.
+	Level(event EventType, index int64, level float64) (float64, bool)
+
+	// Mix returns the value of the channel offset samples after its
+	// latest event, where step is the current time in radians.
+	Mix(c *Channel, step float64, offset int64) float64
+
+	// Validate returns an error if the parameters cannot be played.
+	Validate() error
+}
+
+// Loader is an instrument that plays files, which are read after the
+// instrument is decoded.
+type Loader interface {
+	// Load reads the files of the instrument, with names relative to dir
+	// unless they are absolute.
+	Load(dir string) error
+}
+
+// DefaultInstrumentType is used for instruments without a Type field.
+const DefaultInstrumentType = "additive"
+
+var instrumentTypes = map[string]func() Instrument{
+	"additive":    func() Instrument { return &Additive{} },
+	"subtractive": func() Instrument { return &Subtractive{} },
+	"fm":          func() Instrument { return &FM{} },
+	"sampler":     func() Instrument { return &Sampler{} },
+	"noise":       func() Instrument { return &Noise{} },
+	"percussion":  func() Instrument { return &Percussion{} },
+}
+
+// InstrumentTypes returns the names of the instrument types in order.
+func InstrumentTypes() []string {
+	var types []string
+	for t := range instrumentTypes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewInstrument returns a zero instrument of the named type.
+func NewInstrument(typ string) (Instrument, error) {
+	if typ == "" {
+		typ = DefaultInstrumentType
+	}
+	f, ok := instrumentTypes[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown instrument type %q", typ)
+	}
+	return f(), nil
+}
+
+// UnmarshalInstrument decodes a JSON object into the instrument type named
+// by its Type field.
+func UnmarshalInstrument(data []byte) (Instrument, error) {
+	var t struct {
+		Type string
+	}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	inst, err := NewInstrument(t.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, inst); err != nil {
+		return nil, err
+	}
+	return inst, nil
+}
+
+// CopyInstrument returns a deep copy of an instrument.
+func CopyInstrument(inst Instrument) (Instrument, error) {
+	d, err := MarshalInstrument(inst)
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalInstrument(d)
+}
+
+// PatchInstrument returns a copy of an instrument with the fields of the
+// JSON object patch replaced. The patch cannot change the type.
+func PatchInstrument(inst Instrument, patch []byte) (Instrument, error) {
+	var t struct {
+		Type *string
+	}
+	if err := json.Unmarshal(patch, &t); err != nil {
+		return nil, err
+	}
+	if t.Type != nil && *t.Type != inst.Type() {
+		return nil, fmt.Errorf("cannot change type %q to %q", inst.Type(), *t.Type)
+	}
+
+	p, err := CopyInstrument(inst)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// MarshalInstrument encodes an instrument as a JSON object with its Type
+// field first.
+func MarshalInstrument(inst Instrument) ([]byte, error) {
+	d, err := json.Marshal(inst)
+	if err != nil {
+		return nil, err
+	}
+	if len(d) < 2 || d[0] != '{' {
+		return nil, fmt.Errorf("instrument %q is not a JSON object", inst.Type())
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `{"Type":%q`, inst.Type())
+	if len(bytes.TrimSpace(d[1:len(d)-1])) > 0 {
+		buf.WriteByte(',')
+	}
+	buf.Write(d[1:])
+	return buf.Bytes(), nil
+}
+
+// Instruments is a list of instruments of any type.
+type Instruments []Instrument
+
+func (is Instruments) MarshalJSON() ([]byte, error) {
+	raw := make([]json.RawMessage, len(is))
+	for i, inst := range is {
+		d, err := MarshalInstrument(inst)
+		if err != nil {
+			return nil, err
+		}
+		raw[i] = d
+	}
+	return json.Marshal(raw)
+}
+
+func (is *Instruments) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	ret := make(Instruments, len(raw))
+	for i, d := range raw {
+		inst, err := UnmarshalInstrument(d)
+		if err != nil {
+			return fmt.Errorf("instrument %d: %v", i, err)
+		}
+		ret[i] = inst
+	}
+	*is = ret
+	return nil
+}
+
+// ADSR is the amplitude envelope shared by all instrument types.
+type ADSR struct {
+	Attack  Envelope
+	Decay   Envelope
+	Sustain Envelope
+	Release Envelope
+}
+
+func (e *Envelope) validate(name string) error {
+	if e.Time < 0 {
+		return fmt.Errorf("%s time %d is negative", name, e.Time)
+	}
+	if e.Value < 0 {
+		return fmt.Errorf("%s value %g is negative", name, e.Value)
+	}
+	return nil
+}
+
+func (env *ADSR) Validate() error {
+	if err := env.Attack.validate("attack"); err != nil {
+		return err
+	}
+	if err := env.Decay.validate("decay"); err != nil {
+		return err
+	}
+	if err := env.Sustain.validate("sustain"); err != nil {
+		return err
+	}
+	return env.Release.validate("release")
+}
+
+func interpolate(index int64, e1 Envelope, val float64) float64 {
+	lev := (e1.Value-val)/float64(e1.Time)*float64(index) + val
+	if lev < 1e-10 {
+		lev = 0
+	}
+	return lev
+}
+
+func (env *ADSR) Level(event EventType, index int64, level float64) (float64, bool) {
+	if index < 0 {
+		return 0, false
+	}
+
+	switch event {
+	case EventOn:
+		if index < env.Attack.Time {
+			return interpolate(index, env.Attack, level), true
+		}
+		index -= env.Attack.Time
+		if index < env.Decay.Time {
+			return interpolate(index, env.Decay, env.Attack.Value), true
+		}
+		index -= env.Decay.Time
+		if index < env.Sustain.Time {
+			return interpolate(index, env.Sustain, env.Decay.Value), true
+		}
+		index -= env.Sustain.Time
+		if index < env.Release.Time {
+			return interpolate(index, env.Release, env.Sustain.Value), true
+		}
+	case EventOff:
+		if index < env.Release.Time {
+			return interpolate(index, env.Release, level), true
+		}
+	}
+
+	return 0, false
+}
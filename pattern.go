@@ -0,0 +1,197 @@
+package aujo
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Order is the order in which a pattern plays the notes of a chord.
+type Order string
+
+const (
+	OrderRoll   Order = ""       // OrderRoll rolls the notes upward once, without releasing them
+	OrderUp     Order = "up"     // OrderUp plays the notes from the lowest
+	OrderDown   Order = "down"   // OrderDown plays the notes from the highest
+	OrderRandom Order = "random" // OrderRandom plays a random note on each step
+	OrderPlayed Order = "played" // OrderPlayed plays the notes in the order of the chord
+	OrderStrum  Order = "strum"  // OrderStrum plays all notes on each step, alternately up and down
+)
+
+// rollSpacing is the time between the notes of a roll, in samples.
+const rollSpacing = 2000
+
+// Pattern is how a voice plays a chord: the order of the notes and a
+// rhythm over the duration of the chord.
+type Pattern struct {
+	Order Order
+	// Steps is the rhythm over a chord. Each step is x for a note, X for an
+	// accented note, - to hold the previous note and . for a rest. When
+	// empty, Hits notes are spread evenly over Pulses steps, or each note
+	// of the chord is played once.
+	Steps  string
+	Hits   int
+	Pulses int
+	// Strum is the time between the notes of a strum, in samples.
+	Strum int64
+	// Swing delays every other step by a fraction of a step.
+	Swing float64
+	// Humanize is the largest random delay of a note, as a fraction of a
+	// step, and the largest random change of its velocity.
+	Humanize float64
+}
+
+// Validate returns an error if the pattern cannot be played.
+func (p *Pattern) Validate() error {
+	switch p.Order {
+	case OrderRoll, OrderUp, OrderDown, OrderRandom, OrderPlayed, OrderStrum:
+	default:
+		return fmt.Errorf("unknown order %q", p.Order)
+	}
+	for _, c := range p.Steps {
+		if !strings.ContainsRune("xX-.", c) {
+			return fmt.Errorf("step %q is not one of x, X, - and .", c)
+		}
+	}
+	if p.Hits < 0 || p.Pulses < 0 || p.Hits > p.Pulses {
+		return fmt.Errorf("%d hits do not fit in %d pulses", p.Hits, p.Pulses)
+	}
+	if p.Strum < 0 {
+		return fmt.Errorf("strum cannot be negative")
+	}
+	if p.Swing < 0 || p.Swing >= 1 || p.Humanize < 0 || p.Humanize > 1 {
+		return fmt.Errorf("swing must be in [0, 1) and humanize in [0, 1]")
+	}
+	return nil
+}
+
+// Euclid returns steps with hits spread as evenly as possible over pulses,
+// starting with a hit.
+func Euclid(hits int, pulses int) string {
+	var b strings.Builder
+	for i := 0; i < pulses; i++ {
+		if hits > 0 && (i*hits)%pulses < hits {
+			b.WriteByte('x')
+		} else {
+			b.WriteByte('.')
+		}
+	}
+	return b.String()
+}
+
+// steps returns the rhythm of the pattern for a chord of n notes.
+func (p *Pattern) steps(n int) string {
+	if p.Steps != "" {
+		return p.Steps
+	}
+	if p.Pulses > 0 {
+		return Euclid(p.Hits, p.Pulses)
+	}
+	return strings.Repeat("x", n)
+}
+
+// Events returns the events that play a chord on a voice for a duration
+// from a time. A chord shorter than the steps of the pattern is not
+// played.
+func (p *Pattern) Events(voice int, notes []float64, start int64, duration int64) []Event {
+	var events []Event
+	if len(notes) == 0 {
+		return nil
+	}
+	if p.Order == OrderRoll {
+		for i, f := range notes {
+			events = append(events, Event{
+				Time:  start + rollSpacing*int64(i),
+				Voice: voice,
+				Type:  EventOn,
+				Pitch: f,
+			})
+		}
+		return events
+	}
+
+	ordered := append([]float64(nil), notes...)
+	switch p.Order {
+	case OrderUp, OrderStrum:
+		sort.Float64s(ordered)
+	case OrderDown:
+		sort.Sort(sort.Reverse(sort.Float64Slice(ordered)))
+	}
+
+	steps := p.steps(len(notes))
+	step := duration / int64(len(steps))
+	if step == 0 {
+		return nil
+	}
+	var playing []float64
+	release := func(t int64) {
+		for _, f := range playing {
+			events = append(events, Event{Time: t, Voice: voice, Type: EventOff, Pitch: f})
+		}
+		playing = playing[:0]
+	}
+
+	hit := 0
+	for i, s := range steps {
+		t := start + int64(i)*step
+		if i%2 == 1 {
+			t += int64(p.Swing * float64(step))
+		}
+		if s == '-' {
+			continue
+		}
+		if p.Humanize > 0 {
+			t += int64(rand.Float64() * p.Humanize * float64(step))
+		}
+		// keep the notes before the release at the next step
+		last := start + int64(i+1)*step - 1
+		if t > last {
+			t = last
+		}
+		release(t)
+		if s == '.' {
+			continue
+		}
+
+		velocity := 0.8
+		if s == 'X' {
+			velocity = 1
+		}
+		if p.Humanize > 0 {
+			velocity *= 1 - rand.Float64()*p.Humanize/2
+		}
+
+		var fs []float64
+		switch p.Order {
+		case OrderStrum:
+			fs = append(fs, ordered...)
+			if hit%2 == 1 {
+				sort.Sort(sort.Reverse(sort.Float64Slice(fs)))
+			}
+		case OrderRandom:
+			fs = []float64{ordered[rand.Intn(len(ordered))]}
+		default:
+			fs = []float64{ordered[hit%len(ordered)]}
+		}
+		for j, f := range fs {
+			on := t + p.Strum*int64(j)
+			if on > last {
+				on = last
+			}
+			events = append(events, Event{
+				Time:     on,
+				Voice:    voice,
+				Type:     EventOn,
+				Pitch:    f,
+				Velocity: velocity,
+			})
+		}
+		playing = append(playing, fs...)
+		hit++
+	}
+	release(start + duration)
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time < events[j].Time })
+	return events
+}
@@ -0,0 +1,126 @@
+package aujo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPatternReleases(t *testing.T) {
+	notes := []float64{60, 64, 67, 71}
+	tests := []Pattern{
+		{Order: OrderStrum, Steps: "xxxx", Strum: 5000},
+		{Order: OrderStrum, Hits: 3, Pulses: 8, Strum: 100, Swing: 0.9, Humanize: 1},
+		{Order: OrderUp, Steps: "x-x.xxX-", Swing: 0.5, Humanize: 0.8},
+		{Order: OrderRandom, Hits: 5, Pulses: 8, Humanize: 1},
+	}
+	for _, p := range tests {
+		for _, duration := range []int64{8, 100, 44100} {
+			playing := make(map[float64]bool)
+			for _, e := range p.Events(0, notes, 1000, duration) {
+				if e.Time < 1000 || e.Time > 1000+duration {
+					t.Errorf("%+v over %d: event at %d is outside the chord", p, duration, e.Time)
+				}
+				switch e.Type {
+				case EventOn:
+					playing[e.Pitch] = true
+				case EventOff:
+					if !playing[e.Pitch] {
+						t.Errorf("%+v over %d: %g is released at %d before it is played", p, duration, e.Pitch, e.Time)
+					}
+					playing[e.Pitch] = false
+				}
+			}
+			for f, on := range playing {
+				if on {
+					t.Errorf("%+v over %d: %g is not released", p, duration, f)
+				}
+			}
+		}
+	}
+}
+
+func TestPatternShortChord(t *testing.T) {
+	p := Pattern{Order: OrderUp, Steps: "xxxxxxxx"}
+	if es := p.Events(0, []float64{60, 64, 67}, 0, 7); es != nil {
+		t.Errorf("a chord shorter than its steps has events %v", es)
+	}
+}
+
+func TestEuclid(t *testing.T) {
+	tests := []struct {
+		hits, pulses int
+		want         string
+	}{
+		{0, 0, ""},
+		{0, 4, "...."},
+		{1, 4, "x..."},
+		{4, 4, "xxxx"},
+		{3, 8, "x..x..x."},
+		{5, 8, "x.x.xx.x"},
+		{2, 5, "x..x."},
+	}
+	for _, tt := range tests {
+		if got := Euclid(tt.hits, tt.pulses); got != tt.want {
+			t.Errorf("Euclid(%d, %d) = %q, want %q", tt.hits, tt.pulses, got, tt.want)
+		}
+	}
+}
+
+func TestPatternEvents(t *testing.T) {
+	on := func(time int64, pitch float64, velocity float64) Event {
+		return Event{Time: time, Voice: 1, Type: EventOn, Pitch: pitch, Velocity: velocity}
+	}
+	off := func(time int64, pitch float64) Event {
+		return Event{Time: time, Voice: 1, Type: EventOff, Pitch: pitch}
+	}
+	notes := []float64{64, 60, 67}
+	tests := []struct {
+		p        Pattern
+		duration int64
+		want     []Event
+	}{
+		{
+			Pattern{Order: OrderRoll}, 400,
+			[]Event{on(0, 64, 0), on(2000, 60, 0), on(4000, 67, 0)},
+		},
+		{
+			Pattern{Order: OrderPlayed}, 300,
+			[]Event{on(0, 64, 0.8), off(100, 64), on(100, 60, 0.8), off(200, 60), on(200, 67, 0.8), off(300, 67)},
+		},
+		{
+			Pattern{Order: OrderUp, Steps: "X.x-"}, 400,
+			[]Event{on(0, 60, 1), off(100, 60), on(200, 64, 0.8), off(400, 64)},
+		},
+		{
+			Pattern{Order: OrderDown, Hits: 3, Pulses: 8}, 800,
+			[]Event{on(0, 67, 0.8), off(100, 67), on(300, 64, 0.8), off(400, 64), on(600, 60, 0.8), off(700, 60)},
+		},
+		{
+			Pattern{Order: OrderUp, Steps: "xxxx", Swing: 0.5}, 400,
+			[]Event{
+				on(0, 60, 0.8), off(150, 60), on(150, 64, 0.8), off(200, 64),
+				on(200, 67, 0.8), off(350, 67), on(350, 60, 0.8), off(400, 60),
+			},
+		},
+		{
+			Pattern{Order: OrderStrum, Steps: "xx", Strum: 10}, 200,
+			[]Event{
+				on(0, 60, 0.8), on(10, 64, 0.8), on(20, 67, 0.8),
+				off(100, 60), off(100, 64), off(100, 67),
+				on(100, 67, 0.8), on(110, 64, 0.8), on(120, 60, 0.8),
+				off(200, 67), off(200, 64), off(200, 60),
+			},
+		},
+		{
+			// a strum longer than a step is cut short at the end of the step
+			Pattern{Order: OrderStrum, Steps: "x.", Strum: 40}, 100,
+			[]Event{on(0, 60, 0.8), on(40, 64, 0.8), on(49, 67, 0.8), off(50, 60), off(50, 64), off(50, 67)},
+		},
+	}
+	for _, tt := range tests {
+		got := tt.p.Events(1, notes, 0, tt.duration)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v over %d:\n got %+v\nwant %+v", tt.p, tt.duration, got, tt.want)
+		}
+	}
+}
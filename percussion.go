@@ -0,0 +1,251 @@
+package aujo
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rwelin/aujo/dsp"
+)
+
+// Noise is an instrument that plays "white", "pink" or "brown" noise
+// through a filter. The filter is bypassed when it has neither Cutoff nor
+// EnvAmount, and its key tracking follows the pitch of the channel.
+type Noise struct {
+	Color  string
+	Filter Filter
+
+	ADSR
+}
+
+type noiseState struct {
+	noise  dsp.NoiseSource
+	filter filterState
+}
+
+func (inst *Noise) Type() string {
+	return "noise"
+}
+
+func (inst *Noise) Validate() error {
+	if dsp.NewNoise(inst.Color, 0) == nil {
+		return fmt.Errorf("unknown noise color %q", inst.Color)
+	}
+	if err := inst.Filter.Validate(); err != nil {
+		return err
+	}
+	return inst.ADSR.Validate()
+}
+
+// noiseSeed returns the seed of the noise of a channel, so that notes that
+// play at the same time do not play the same noise.
+func noiseSeed(c *Channel) uint64 {
+	return uint64(c.startTime)<<20 ^ math.Float64bits(c.Pitch)
+}
+
+func (inst *Noise) Mix(c *Channel, step float64, offset int64) float64 {
+	st, _ := c.state.(*noiseState)
+	if st == nil {
+		st = &noiseState{
+			noise:  dsp.NewNoise(inst.Color, noiseSeed(c)),
+			filter: filterState{eventTime: c.EventTime},
+		}
+		c.state = st
+	}
+	if st.noise == nil {
+		return 0
+	}
+
+	x := st.noise.Next()
+	if inst.Filter.Cutoff == 0 && inst.Filter.EnvAmount == 0 {
+		return x
+	}
+	return inst.Filter.process(&st.filter, c, x, pitchToFreq(c.Pitch), offset)
+}
+
+// hihatRatios are the frequencies of the square waves of a TR-808 hi-hat
+// relative to the lowest one.
+var hihatRatios = []float64{1, 1.4827, 1.8003, 2.5462, 2.6304, 3.8968}
+
+// Percussion is an instrument for drum sounds, selected by Sound:
+//
+// "kick" is a sine that sweeps down to the pitch with a click of noise.
+// "snare" is a sweeping sine at the pitch with highpassed noise.
+// "hihat" is highpassed noise with metallic square waves at the pitch.
+//
+// Sweep is the start of the tone in semitones above the pitch, and
+// SweepTime and NoiseDecay are time constants in samples, where zero ends
+// at once. Parameters that are left out take the defaults of the sound.
+// The ADSR envelope shapes the sound as a whole, so a long Release turns a
+// closed hi-hat into an open one.
+type Percussion struct {
+	Sound      string
+	Sweep      *float64
+	SweepTime  *float64
+	ToneLevel  *float64
+	NoiseLevel *float64
+	NoiseColor string
+	NoiseDecay *float64
+	Cutoff     *float64 // Cutoff is the highpass frequency of the noise in Hz
+	Resonance  *float64
+
+	ADSR
+}
+
+// percussionParams are the parameters of a percussion sound.
+type percussionParams struct {
+	Sweep      float64
+	SweepTime  float64
+	ToneLevel  float64
+	NoiseLevel float64
+	NoiseDecay float64
+	Cutoff     float64
+	Resonance  float64
+}
+
+var percussionDefaults = map[string]percussionParams{
+	"kick": {
+		Sweep:      24,
+		SweepTime:  1500,
+		ToneLevel:  1,
+		NoiseLevel: 0.3,
+		NoiseDecay: 200,
+		Cutoff:     2000,
+	},
+	"snare": {
+		Sweep:      7,
+		SweepTime:  800,
+		ToneLevel:  0.5,
+		NoiseLevel: 0.8,
+		NoiseDecay: 5000,
+		Cutoff:     1500,
+	},
+	"hihat": {
+		ToneLevel:  0.3,
+		NoiseLevel: 0.7,
+		NoiseDecay: 3000,
+		Cutoff:     7000,
+		Resonance:  0.2,
+	},
+}
+
+// params returns the parameters of the instrument, with the defaults of
+// the sound for those that are left out.
+func (inst *Percussion) params() percussionParams {
+	p := percussionDefaults[inst.Sound]
+	if inst.Sweep != nil {
+		p.Sweep = *inst.Sweep
+	}
+	if inst.SweepTime != nil {
+		p.SweepTime = *inst.SweepTime
+	}
+	if inst.ToneLevel != nil {
+		p.ToneLevel = *inst.ToneLevel
+	}
+	if inst.NoiseLevel != nil {
+		p.NoiseLevel = *inst.NoiseLevel
+	}
+	if inst.NoiseDecay != nil {
+		p.NoiseDecay = *inst.NoiseDecay
+	}
+	if inst.Cutoff != nil {
+		p.Cutoff = *inst.Cutoff
+	}
+	if inst.Resonance != nil {
+		p.Resonance = *inst.Resonance
+	}
+	return p
+}
+
+// decay returns the level after t samples of an exponential decay with a
+// time constant. A zero time constant ends at once.
+func decay(t float64, tc float64) float64 {
+	if tc == 0 {
+		return 0
+	}
+	return math.Exp(-t / tc)
+}
+
+type percussionState struct {
+	sound  string
+	params percussionParams // params are the parameters of the latest note
+	start  int64            // start is the start time of the note of params
+	noise  dsp.NoiseSource
+	filter dsp.SVF
+	phase  float64
+}
+
+func (inst *Percussion) Type() string {
+	return "percussion"
+}
+
+func (inst *Percussion) Validate() error {
+	if _, ok := percussionDefaults[inst.Sound]; !ok {
+		return fmt.Errorf("unknown percussion sound %q", inst.Sound)
+	}
+	if inst.NoiseColor != "" && dsp.NewNoise(inst.NoiseColor, 0) == nil {
+		return fmt.Errorf("unknown noise color %q", inst.NoiseColor)
+	}
+	p := inst.params()
+	if p.SweepTime < 0 || p.NoiseDecay < 0 {
+		return fmt.Errorf("time constants cannot be negative")
+	}
+	if p.Resonance < 0 || p.Resonance >= 1 {
+		return fmt.Errorf("resonance %g is not in [0, 1)", p.Resonance)
+	}
+	return inst.ADSR.Validate()
+}
+
+func (inst *Percussion) Mix(c *Channel, step float64, offset int64) float64 {
+	st, _ := c.state.(*percussionState)
+	if st == nil {
+		st = &percussionState{
+			sound:  inst.Sound,
+			params: inst.params(),
+			start:  c.startTime,
+			noise:  dsp.NewNoise(inst.NoiseColor, noiseSeed(c)),
+		}
+		if st.noise == nil {
+			st.noise = dsp.NewNoise("white", noiseSeed(c))
+		}
+		c.state = st
+	} else if st.start != c.startTime {
+		// a new note picks up changes of the instrument
+		st.sound = inst.Sound
+		st.params = inst.params()
+		st.start = c.startTime
+	}
+
+	p := &st.params
+	t := float64(c.EventTime + offset - c.startTime)
+	f := pitchToFreq(c.Pitch)
+
+	noise := st.noise.Next() * p.NoiseLevel * decay(t, p.NoiseDecay)
+
+	var tone float64
+	switch st.sound {
+	case "kick", "snare":
+		sweep := p.Sweep * decay(t, p.SweepTime)
+		st.phase += 2 * math.Pi * f * math.Exp2(sweep/12) / SamplingFrequency
+		if st.phase > 2*math.Pi {
+			st.phase -= 2 * math.Pi
+		}
+		tone = p.ToneLevel * math.Sin(st.phase)
+	case "hihat":
+		st.phase += f / SamplingFrequency
+		for _, r := range hihatRatios {
+			if math.Mod(st.phase*r, 1) < 0.5 {
+				tone += 1
+			} else {
+				tone -= 1
+			}
+		}
+		tone *= p.ToneLevel / float64(len(hihatRatios))
+		_, _, tone = st.filter.Process(tone+noise, p.Cutoff/SamplingFrequency, p.Resonance)
+		return tone
+	default:
+		return 0
+	}
+
+	_, _, high := st.filter.Process(noise, p.Cutoff/SamplingFrequency, p.Resonance)
+	return tone + high
+}
@@ -0,0 +1,40 @@
+package aujo
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestPercussionDefaults(t *testing.T) {
+	tests := []struct {
+		json  string
+		sweep float64
+		decay float64
+	}{
+		{`{"Sound": "kick"}`, 24, 200},
+		{`{"Sound": "kick", "Sweep": 0}`, 0, 200},
+		{`{"Sound": "kick", "Sweep": 12, "NoiseDecay": 0}`, 12, 0},
+		{`{"Sound": "kick", "Sweep": null}`, 24, 200},
+	}
+	for _, tt := range tests {
+		var inst Percussion
+		if err := json.Unmarshal([]byte(tt.json), &inst); err != nil {
+			t.Fatal(err)
+		}
+		if err := inst.Validate(); err != nil {
+			t.Errorf("%s: %v", tt.json, err)
+		}
+		p := inst.params()
+		if p.Sweep != tt.sweep || p.NoiseDecay != tt.decay {
+			t.Errorf("%s: sweep %g and noise decay %g, want %g and %g", tt.json, p.Sweep, p.NoiseDecay, tt.sweep, tt.decay)
+		}
+
+		c := &Channel{Pitch: 36, Event: EventOn}
+		for i := int64(0); i < 1000; i++ {
+			if x := inst.Mix(c, 0, i); math.IsNaN(x) || math.IsInf(x, 0) {
+				t.Fatalf("%s: sample %d is %g", tt.json, i, x)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package preset
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/rwelin/aujo"
+)
+
+// Change is a field that differs between two instruments. A and B are the
+// JSON values of the field, nil where the field is missing.
+type Change struct {
+	Path string // Path is like "Filter.Cutoff" or "Harmonics[3]"
+	A    interface{}
+	B    interface{}
+}
+
+func (c Change) String() string {
+	a, _ := json.Marshal(c.A)
+	b, _ := json.Marshal(c.B)
+	if c.A == nil {
+		a = []byte("-")
+	}
+	if c.B == nil {
+		b = []byte("-")
+	}
+	return fmt.Sprintf("%s: %s -> %s", c.Path, a, b)
+}
+
+func decode(inst aujo.Instrument) (interface{}, error) {
+	data, err := aujo.MarshalInstrument(inst)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Diff returns the fields that differ between two instruments, in order of
+// their paths.
+func Diff(a aujo.Instrument, b aujo.Instrument) ([]Change, error) {
+	va, err := decode(a)
+	if err != nil {
+		return nil, err
+	}
+	vb, err := decode(b)
+	if err != nil {
+		return nil, err
+	}
+	return diff(nil, "", va, vb), nil
+}
+
+func diff(changes []Change, path string, a interface{}, b interface{}) []Change {
+	switch ta := a.(type) {
+	case map[string]interface{}:
+		tb, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		var keys []string
+		for k := range ta {
+			keys = append(keys, k)
+		}
+		for k := range tb {
+			if _, ok := ta[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			changes = diff(changes, p, ta[k], tb[k])
+		}
+		return changes
+	case []interface{}:
+		tb, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(ta) || i < len(tb); i++ {
+			var ea, eb interface{}
+			if i < len(ta) {
+				ea = ta[i]
+			}
+			if i < len(tb) {
+				eb = tb[i]
+			}
+			changes = diff(changes, fmt.Sprintf("%s[%d]", path, i), ea, eb)
+		}
+		return changes
+	}
+	if !reflect.DeepEqual(a, b) {
+		changes = append(changes, Change{Path: path, A: a, B: b})
+	}
+	return changes
+}
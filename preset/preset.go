@@ -0,0 +1,127 @@
+// Package preset stores named instrument presets as JSON files in a
+// directory.
+package preset
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rwelin/aujo"
+	"github.com/rwelin/aujo/config"
+)
+
+var (
+	ErrNotFound = errors.New("preset not found")
+	ErrName     = errors.New("invalid preset name")
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 _.-]*$`)
+
+const ext = ".json"
+
+// Store is a directory of presets, one file per preset.
+type Store struct {
+	Dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+func (s *Store) path(name string) (string, error) {
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("%q: %w", name, ErrName)
+	}
+	return filepath.Join(s.Dir, name+ext), nil
+}
+
+// List returns the names of the presets in order.
+func (s *Store) List() ([]string, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ext)
+		if f.Mode().IsRegular() && name != f.Name() && validName.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Load returns the named preset.
+func (s *Store) Load(name string) (aujo.Instrument, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%q: %w", name, ErrNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	inst, err := aujo.UnmarshalInstrument(data)
+	if err != nil {
+		return nil, fmt.Errorf("preset %q: %v", name, err)
+	}
+	return inst, nil
+}
+
+// Save stores an instrument as the named preset, replacing any preset with
+// the same name.
+func (s *Store) Save(name string, inst aujo.Instrument) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := inst.Validate(); err != nil {
+		return err
+	}
+	data, err := aujo.MarshalInstrument(inst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	return config.WriteFile(p, append(data, '\n'))
+}
+
+// Delete removes the named preset.
+func (s *Store) Delete(name string) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); os.IsNotExist(err) {
+		return fmt.Errorf("%q: %w", name, ErrNotFound)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Diff returns the differences between two presets.
+func (s *Store) Diff(a string, b string) ([]Change, error) {
+	ia, err := s.Load(a)
+	if err != nil {
+		return nil, err
+	}
+	ib, err := s.Load(b)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(ia, ib)
+}
@@ -0,0 +1,159 @@
+package preset
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/rwelin/aujo"
+)
+
+func tempStore(t *testing.T) *Store {
+	dir, err := ioutil.TempDir("", "preset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewStore(dir)
+}
+
+func TestStore(t *testing.T) {
+	s := tempStore(t)
+	defer os.RemoveAll(s.Dir)
+	if names, err := s.List(); err != nil || len(names) != 0 {
+		t.Fatalf("List() of an empty store = %v, %v", names, err)
+	}
+
+	organ := &aujo.Additive{Harmonics: []float64{1, 0.5, 0.25}}
+	if err := s.Save("organ", organ); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save("Bell 2", &aujo.Noise{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save("Bell 2", &aujo.Additive{Harmonics: []float64{1}}); err != nil {
+		t.Fatalf("replacing a preset: %v", err)
+	}
+	if err := s.Save("bad", &aujo.Additive{ADSR: aujo.ADSR{Attack: aujo.Envelope{Time: -1}}}); err == nil {
+		t.Error("an invalid instrument is saved")
+	}
+
+	names, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Bell 2", "organ"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("List() = %v, want %v", names, want)
+	}
+
+	inst, err := s.Load("organ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inst, organ) {
+		t.Errorf("Load(organ) = %+v, want %+v", inst, organ)
+	}
+	if inst, err := s.Load("Bell 2"); err != nil || inst.Type() != "additive" {
+		t.Errorf("Load of a replaced preset = %v, %v", inst, err)
+	}
+
+	if err := s.Delete("organ"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load("organ"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Load of a deleted preset: %v, want %v", err, ErrNotFound)
+	}
+	if err := s.Delete("organ"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of a deleted preset: %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestNames(t *testing.T) {
+	s := tempStore(t)
+	defer os.RemoveAll(s.Dir)
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"piano", true},
+		{"Pad 2_soft-v1.0", true},
+		{"0", true},
+		{"", false},
+		{" piano", false},
+		{".hidden", false},
+		{"-piano", false},
+		{"../piano", false},
+		{"sub/piano", false},
+		{`sub\piano`, false},
+		{"piano\n", false},
+	}
+	for _, tt := range tests {
+		err := s.Save(tt.name, &aujo.Additive{})
+		if tt.valid && err != nil {
+			t.Errorf("Save(%q): %v", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrName) {
+			t.Errorf("Save(%q): %v, want %v", tt.name, err, ErrName)
+		}
+		if _, err := s.Load(tt.name); !tt.valid && !errors.Is(err, ErrName) {
+			t.Errorf("Load(%q): %v, want %v", tt.name, err, ErrName)
+		}
+		if err := s.Delete(tt.name); !tt.valid && !errors.Is(err, ErrName) {
+			t.Errorf("Delete(%q): %v, want %v", tt.name, err, ErrName)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	base := &aujo.Additive{Harmonics: []float64{1, 0.5}}
+	tests := []struct {
+		a     aujo.Instrument
+		b     aujo.Instrument
+		paths []string
+	}{
+		{base, &aujo.Additive{Harmonics: []float64{1, 0.5}}, nil},
+		{base, &aujo.Additive{Harmonics: []float64{1, 0.25}}, []string{"Harmonics[1]"}},
+		{base, &aujo.Additive{Harmonics: []float64{1, 0.5, 0.1}}, []string{"Harmonics[2]"}},
+		{base, &aujo.Additive{Harmonics: []float64{1}}, []string{"Harmonics[1]"}},
+		{
+			base,
+			&aujo.Additive{
+				Harmonics:   []float64{1, 0.5},
+				ADSR:        aujo.ADSR{Release: aujo.Envelope{Time: 10}},
+				Attenuation: aujo.Attenuation{P1: 1},
+			},
+			[]string{"Attenuation.P1", "Release.Time"},
+		},
+		{base, &aujo.Noise{}, []string{"Attenuation", "Color", "Filter", "Harmonics", "Type"}},
+	}
+	for _, tt := range tests {
+		changes, err := Diff(tt.a, tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, c := range changes {
+			paths = append(paths, c.Path)
+		}
+		if !reflect.DeepEqual(paths, tt.paths) {
+			t.Errorf("Diff(%+v, %+v) = %v, want changes of %v", tt.a, tt.b, changes, tt.paths)
+		}
+	}
+}
+
+func TestChangeString(t *testing.T) {
+	tests := []struct {
+		c    Change
+		want string
+	}{
+		{Change{"Harmonics[1]", 0.5, 0.25}, "Harmonics[1]: 0.5 -> 0.25"},
+		{Change{"Harmonics[2]", nil, 0.1}, "Harmonics[2]: - -> 0.1"},
+		{Change{"Type", "additive", "noise"}, `Type: "additive" -> "noise"`},
+	}
+	for _, tt := range tests {
+		if got := tt.c.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.c, got, tt.want)
+		}
+	}
+}
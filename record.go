@@ -0,0 +1,237 @@
+package aujo
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rwelin/aujo/wav"
+)
+
+// recordingFormat is the format of the WAVE files of recordings.
+var recordingFormat = wav.Format{
+	SampleRate:    int(SamplingFrequency),
+	Channels:      1,
+	BitsPerSample: 16,
+}
+
+// LogEntry is a message of the mix placed in a recording.
+type LogEntry struct {
+	Offset int64 // Offset is the sample of the recording where the message took effect
+	Message
+}
+
+// timeline places the notes and sequences of the mix in the audio that a
+// sink writes.
+type timeline struct {
+	mutex   sync.Mutex
+	pending []Message
+	written int64 // written is the number of samples placed so far
+	cancel  func()
+	done    chan struct{}
+}
+
+func (m *Mix) newTimeline() *timeline {
+	msgs, cancel := m.Subscribe(256)
+	t := &timeline{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(t.done)
+		for msg := range msgs {
+			if isLogType(msg.Type) {
+				t.mutex.Lock()
+				t.pending = append(t.pending, msg)
+				t.mutex.Unlock()
+			}
+		}
+	}()
+	return t
+}
+
+// place returns the messages that took effect in a block of n samples
+// played at time. Messages from before the first block are dropped.
+func (t *timeline) place(time int64, n int64) []LogEntry {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var entries []LogEntry
+	i := 0
+	for ; i < len(t.pending) && t.pending[i].Time < time+n; i++ {
+		offset := t.written + t.pending[i].Time - time
+		if offset >= 0 {
+			entries = append(entries, LogEntry{Offset: offset, Message: t.pending[i]})
+		}
+	}
+	t.pending = t.pending[i:]
+	t.written += n
+	return entries
+}
+
+func (t *timeline) stop() {
+	t.cancel()
+	<-t.done
+}
+
+// Recording writes the audio of a mix to a WAVE file while it plays.
+type Recording struct {
+	sink    *Sink
+	wav     *wav.Writer
+	log     *json.Encoder
+	tl      *timeline
+	samples int64
+}
+
+// Record starts writing the audio of the mix to w, and the notes and
+// sequences that are played to log as JSON lines of LogEntry.
+func (m *Mix) Record(w io.WriteSeeker, log io.Writer) (*Recording, error) {
+	ww, err := wav.NewWriter(w, recordingFormat)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recording{
+		wav: ww,
+		log: json.NewEncoder(log),
+		tl:  m.newTimeline(),
+	}
+	r.sink = m.attach(r, 16, OverflowDropNewest)
+	return r, nil
+}
+
+func (r *Recording) writeBlock(time int64, p []byte) error {
+	if _, err := r.wav.Write(p); err != nil {
+		return err
+	}
+	n := int64(len(p) / 2)
+	atomic.AddInt64(&r.samples, n)
+	for _, e := range r.tl.place(time, n) {
+		if err := r.log.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Samples returns the number of samples recorded so far.
+func (r *Recording) Samples() int64 {
+	return atomic.LoadInt64(&r.samples)
+}
+
+// Dropped returns the number of blocks missing from the recording because
+// writing did not keep up.
+func (r *Recording) Dropped() int64 {
+	return r.sink.Dropped()
+}
+
+// Done is closed when the recording has ended, either by Stop or because
+// writing failed.
+func (r *Recording) Done() <-chan struct{} {
+	return r.sink.Done()
+}
+
+// Stop ends the recording and finishes the WAVE file. It returns the error
+// that ended the recording early, if any. The writers are not closed.
+func (r *Recording) Stop() error {
+	r.sink.Detach()
+	r.tl.stop()
+	if err := r.wav.Close(); err != nil {
+		return err
+	}
+	return r.sink.Err()
+}
+
+// Rewind keeps the latest audio of a mix and the notes and sequences
+// played in it, so that they can be saved after they were heard.
+type Rewind struct {
+	sink    *Sink
+	tl      *timeline
+	mutex   sync.Mutex
+	audio   []byte // audio is a ring buffer of samples
+	pos     int    // pos is where the next sample is written in audio
+	full    bool
+	total   int64 // total is the number of samples written
+	entries []LogEntry
+}
+
+// Rewind starts keeping the latest samples of audio of the mix.
+func (m *Mix) Rewind(samples int) *Rewind {
+	r := &Rewind{
+		audio: make([]byte, 2*samples),
+		tl:    m.newTimeline(),
+	}
+	r.sink = m.attach(r, 4, OverflowDropOldest)
+	return r
+}
+
+func (r *Rewind) writeBlock(time int64, p []byte) error {
+	entries := r.tl.place(time, int64(len(p)/2))
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.total += int64(len(p) / 2)
+	for len(p) > 0 {
+		n := copy(r.audio[r.pos:], p)
+		p = p[n:]
+		r.pos += n
+		if r.pos == len(r.audio) {
+			r.pos = 0
+			r.full = true
+		}
+	}
+
+	// forget the messages whose audio has been overwritten
+	r.entries = append(r.entries, entries...)
+	first := r.total - int64(len(r.audio)/2)
+	i := 0
+	for i < len(r.entries) && r.entries[i].Offset < first {
+		i++
+	}
+	r.entries = r.entries[i:]
+	return nil
+}
+
+// Save writes the kept audio to w as a WAVE file and the messages played
+// in it to log like Record does, and returns the number of samples
+// written.
+func (r *Rewind) Save(w io.WriteSeeker, log io.Writer) (int64, error) {
+	r.mutex.Lock()
+	audio := append([]byte(nil), r.audio[:r.pos]...)
+	if r.full {
+		audio = append(append([]byte(nil), r.audio[r.pos:]...), audio...)
+	}
+	entries := append([]LogEntry(nil), r.entries...)
+	start := r.total - int64(len(audio)/2)
+	r.mutex.Unlock()
+
+	ww, err := wav.NewWriter(w, recordingFormat)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := ww.Write(audio); err != nil {
+		return 0, err
+	}
+	if err := ww.Close(); err != nil {
+		return 0, err
+	}
+
+	enc := json.NewEncoder(log)
+	for _, e := range entries {
+		if e.Offset < start {
+			continue
+		}
+		e.Offset -= start
+		if err := enc.Encode(e); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(audio) / 2), nil
+}
+
+// Stop stops keeping audio.
+func (r *Rewind) Stop() {
+	r.sink.Detach()
+	r.tl.stop()
+}
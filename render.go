@@ -0,0 +1,115 @@
+package aujo
+
+import (
+	"math"
+
+	"github.com/rwelin/aujo/dsp"
+)
+
+// BlockSize is the number of samples the mix renders at a time.
+const BlockSize = 16384
+
+// renderDelay is the number of samples by which the output of the
+// renderer lags the events of the mix.
+const renderDelay = BlockSize / 2
+
+// renderer lowpass filters the output of the mix in overlapping blocks.
+type renderer struct {
+	hann    []float64
+	lowpass []float64
+	buf0    []float64
+	buf1    []float64
+	w1      []float64
+	w       []float64
+	out0    []float64
+	out1    []float64
+	out     []float64
+}
+
+func newRenderer() *renderer {
+	const N = BlockSize
+	return &renderer{
+		hann:    dsp.Hann(N),
+		lowpass: dsp.Sinc(N, 600, 4000),
+		buf0:    make([]float64, N),
+		buf1:    make([]float64, N),
+		w1:      make([]float64, N),
+		w:       make([]float64, N),
+		out0:    make([]float64, N),
+		out1:    make([]float64, N),
+		out:     make([]float64, N),
+	}
+}
+
+// next renders the next block of the mix, scaled so that full scale is
+// 1. The returned slice is reused by the following call.
+func (r *renderer) next(m *Mix) []float64 {
+	const N = BlockSize
+	m.fill(r.buf1)
+
+	for i := range r.w1 {
+		r.w1[i] = r.hann[i] * r.buf1[i]
+	}
+
+	dsp.Convolve(r.out1, r.w1, r.lowpass)
+
+	for i := 0; i < N/2; i++ {
+		r.w[i] = r.hann[i] * r.buf0[i+N/2]
+	}
+	for i := N / 2; i < N; i++ {
+		r.w[i] = r.hann[i] * r.buf1[i-N/2]
+	}
+
+	dsp.Convolve(r.out, r.w, r.lowpass)
+
+	for i := 0; i < N/2; i++ {
+		r.out[i] += r.out0[i+N/2]
+	}
+	for i := N / 2; i < N; i++ {
+		r.out[i] += r.out1[i-N/2]
+	}
+
+	r.buf0, r.buf1 = r.buf1, r.buf0
+	r.out0, r.out1 = r.out1, r.out0
+
+	m.Lock()
+	gain := N / 1024 * m.Level / (1 << 15)
+	m.Unlock()
+	for i := range r.out {
+		r.out[i] *= gain
+	}
+
+	m.publishMeter(r.out)
+	return r.out
+}
+
+func toInt16(v float64) int16 {
+	v = math.Round(v * (1 << 15))
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	} else if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+// Render renders n samples of the mix without playing it, scaled so that
+// full scale is 1. The samples start at the start of the mix, without the
+// delay of the renderer. It must not be used while the mix is playing.
+func (m *Mix) Render(n int) []float64 {
+	r := newRenderer()
+	ret := make([]float64, 0, n)
+	skip := renderDelay
+	for len(ret) < n {
+		out := r.next(m)
+		if skip > 0 {
+			out = out[skip:]
+			skip = 0
+		}
+		if len(out) > n-len(ret) {
+			out = out[:n-len(ret)]
+		}
+		ret = append(ret, out...)
+	}
+	return ret
+}
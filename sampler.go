@@ -0,0 +1,215 @@
+package aujo
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rwelin/aujo/wav"
+)
+
+type sample struct {
+	data []float64
+	rate float64
+	loop wav.Loop
+}
+
+type sampleCacheEntry struct {
+	modTime time.Time
+	sample  *sample
+}
+
+// sampleCache keeps decoded files so that reloading a configuration does not
+// read unchanged files again.
+var sampleCache = struct {
+	sync.Mutex
+	files map[string]sampleCacheEntry
+}{
+	files: make(map[string]sampleCacheEntry),
+}
+
+func loadSample(name string) (*sample, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	sampleCache.Lock()
+	defer sampleCache.Unlock()
+
+	if e, ok := sampleCache.files[name]; ok && e.modTime.Equal(fi.ModTime()) {
+		return e.sample, nil
+	}
+
+	f, err := wav.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	s := &sample{
+		data: f.Mono(),
+		rate: float64(f.SampleRate),
+	}
+	if len(f.Loops) > 0 {
+		s.loop = f.Loops[0]
+	}
+	sampleCache.files[name] = sampleCacheEntry{
+		modTime: fi.ModTime(),
+		sample:  s,
+	}
+	return s, nil
+}
+
+// SampleZone maps a WAVE file to a range of pitches and velocities. The
+// ranges are inclusive, and a zero HighPitch or HighVelocity leaves the
+// range open above. The loop is in frames of the file with LoopEnd
+// exclusive. Without LoopStart and LoopEnd the first loop of the file is
+// used, if it has one.
+type SampleZone struct {
+	File         string
+	RootPitch    float64 // RootPitch is the pitch of the recording
+	LowPitch     float64
+	HighPitch    float64
+	LowVelocity  float64
+	HighVelocity float64
+	LoopStart    int64
+	LoopEnd      int64
+	Gain         float64 // Gain scales the sample, zero means 1
+
+	sample *sample
+}
+
+func (z *SampleZone) matches(pitch float64, velocity float64) bool {
+	if pitch < z.LowPitch || z.HighPitch > 0 && pitch > z.HighPitch {
+		return false
+	}
+	if velocity < z.LowVelocity || z.HighVelocity > 0 && velocity > z.HighVelocity {
+		return false
+	}
+	return z.sample != nil
+}
+
+func (z *SampleZone) loop() (int64, int64) {
+	if z.LoopEnd > z.LoopStart {
+		return z.LoopStart, z.LoopEnd
+	}
+	return z.sample.loop.Start, z.sample.loop.End
+}
+
+// at returns the sample at frame i, following the loop.
+func (z *SampleZone) at(i int64) float64 {
+	start, end := z.loop()
+	if end > start && end <= int64(len(z.sample.data)) && i >= end {
+		i = start + (i-start)%(end-start)
+	}
+	if i < 0 || i >= int64(len(z.sample.data)) {
+		return 0
+	}
+	return z.sample.data[i]
+}
+
+// Sampler is an instrument that plays back recordings, resampled to the
+// pitch with cubic interpolation. Vibrato does not affect samples.
+type Sampler struct {
+	Zones []SampleZone
+
+	ADSR
+}
+
+type samplerState struct {
+	eventTime int64
+	zone      int
+}
+
+func (inst *Sampler) Type() string {
+	return "sampler"
+}
+
+func (inst *Sampler) Validate() error {
+	for i, z := range inst.Zones {
+		if z.File == "" {
+			return fmt.Errorf("zone %d has no File", i)
+		}
+		if z.LoopStart < 0 || z.LoopEnd < 0 {
+			return fmt.Errorf("zone %d loop is negative", i)
+		}
+	}
+	return inst.ADSR.Validate()
+}
+
+// Load reads the files of the zones. Zones play nothing until they are
+// loaded.
+func (inst *Sampler) Load(dir string) error {
+	for i := range inst.Zones {
+		z := &inst.Zones[i]
+		name := z.File
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		s, err := loadSample(name)
+		if err != nil {
+			return fmt.Errorf("zone %d: %v", i, err)
+		}
+		if z.LoopEnd > int64(len(s.data)) {
+			return fmt.Errorf("zone %d loop is outside of %s", i, z.File)
+		}
+		z.sample = s
+	}
+	return nil
+}
+
+func (inst *Sampler) zone(pitch float64, velocity float64) int {
+	for i := range inst.Zones {
+		if inst.Zones[i].matches(pitch, velocity) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (inst *Sampler) Mix(c *Channel, step float64, offset int64) float64 {
+	st, _ := c.state.(*samplerState)
+	if st == nil || st.zone >= len(inst.Zones) {
+		st = &samplerState{
+			eventTime: c.EventTime,
+			zone:      inst.zone(c.Pitch, c.Velocity),
+		}
+		c.state = st
+	}
+	if st.eventTime != c.EventTime {
+		st.eventTime = c.EventTime
+		if c.Event == EventOn {
+			st.zone = inst.zone(c.Pitch, c.Velocity)
+		}
+	}
+	if st.zone < 0 {
+		return 0
+	}
+	z := &inst.Zones[st.zone]
+
+	// releases continue the recording from where the note was released
+	t := c.EventTime + offset - c.startTime
+	ratio := pitchToFreq(c.Pitch) / pitchToFreq(z.RootPitch) * z.sample.rate / SamplingFrequency
+	pos := float64(t) * ratio
+	i := int64(math.Floor(pos))
+	x := pos - float64(i)
+
+	y0 := z.at(i - 1)
+	y1 := z.at(i)
+	y2 := z.at(i + 1)
+	y3 := z.at(i + 2)
+
+	// Catmull-Rom spline through y1 and y2
+	a := -0.5*y0 + 1.5*y1 - 1.5*y2 + 0.5*y3
+	b := y0 - 2.5*y1 + 2*y2 - 0.5*y3
+	cc := -0.5*y0 + 0.5*y2
+	v := ((a*x+b)*x+cc)*x + y1
+
+	gain := z.Gain
+	if gain == 0 {
+		gain = 1
+	}
+	return gain * v
+}
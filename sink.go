@@ -0,0 +1,248 @@
+package aujo
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy decides what happens to audio blocks when the buffer of a
+// sink is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes the mix wait for the sink. The mix plays in real
+	// time only if a sink that blocks consumes it in real time.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards new blocks until there is room.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest buffered block to make room.
+	OverflowDropOldest
+)
+
+// Sink writes the audio of a mix to a writer as 16 bit little endian mono
+// PCM. A sink is detached when writing fails.
+type Sink struct {
+	m       *Mix
+	w       blockWriter
+	policy  OverflowPolicy
+	c       chan block
+	done    chan struct{} // done is closed when the sink is detached
+	exited  chan struct{} // exited is closed when the writer has returned
+	once    sync.Once
+	err     error
+	dropped int64
+}
+
+// block is rendered audio, with the time of the mix at its first sample.
+type block struct {
+	time int64
+	data []byte
+}
+
+// blockWriter writes audio knowing the time of the mix when it was
+// played.
+type blockWriter interface {
+	writeBlock(time int64, p []byte) error
+}
+
+type plainWriter struct {
+	w io.Writer
+}
+
+func (pw plainWriter) writeBlock(time int64, p []byte) error {
+	_, err := pw.w.Write(p)
+	return err
+}
+
+type sinks struct {
+	mutex sync.Mutex
+	set   map[*Sink]struct{}
+}
+
+// Attach adds a sink that writes the audio of the mix to w, with room for
+// buffer blocks. The mix starts rendering when the first sink is attached,
+// and renders in real time while no sink with OverflowBlock is attached.
+func (m *Mix) Attach(w io.Writer, buffer int, policy OverflowPolicy) *Sink {
+	return m.attach(plainWriter{w}, buffer, policy)
+}
+
+func (m *Mix) attach(w blockWriter, buffer int, policy OverflowPolicy) *Sink {
+	if buffer < 1 {
+		buffer = 1
+	}
+	s := &Sink{
+		m:      m,
+		w:      w,
+		policy: policy,
+		c:      make(chan block, buffer),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+
+	m.sinks.mutex.Lock()
+	if m.sinks.set == nil {
+		m.sinks.set = make(map[*Sink]struct{})
+	}
+	m.sinks.set[s] = struct{}{}
+	m.sinks.mutex.Unlock()
+
+	go s.write()
+	m.engine.Do(func() {
+		go m.run()
+	})
+	return s
+}
+
+func (s *Sink) write() {
+	defer close(s.exited)
+	for {
+		select {
+		case b := <-s.c:
+			if err := s.w.writeBlock(b.time, b.data); err != nil {
+				s.detach(err)
+				return
+			}
+		case <-s.done:
+			s.drain()
+			return
+		}
+	}
+}
+
+// drain writes the blocks left in the buffer when the sink is detached,
+// unless writing failed.
+func (s *Sink) drain() {
+	if s.err != nil {
+		return
+	}
+	for {
+		select {
+		case b := <-s.c:
+			if err := s.w.writeBlock(b.time, b.data); err != nil {
+				s.err = err
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *Sink) detach(err error) {
+	s.once.Do(func() {
+		s.m.sinks.mutex.Lock()
+		delete(s.m.sinks.set, s)
+		s.m.sinks.mutex.Unlock()
+		s.err = err
+		close(s.done)
+	})
+}
+
+// Detach removes the sink from the mix, and returns when the sink has
+// written the blocks it buffered and no longer writes to its writer.
+func (s *Sink) Detach() {
+	s.detach(nil)
+	<-s.exited
+}
+
+// Done is closed when the sink has been detached.
+func (s *Sink) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error that detached the sink or that writing its
+// buffered blocks failed with, if any.
+func (s *Sink) Err() error {
+	<-s.exited
+	return s.err
+}
+
+// Dropped returns the number of blocks that the sink has discarded.
+func (s *Sink) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// send passes a block to the sink according to its policy.
+func (s *Sink) send(b block) {
+	switch s.policy {
+	case OverflowBlock:
+		select {
+		case s.c <- b:
+		case <-s.done:
+		}
+		return
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.c <- b:
+				return
+			default:
+			}
+			select {
+			case <-s.c:
+				atomic.AddInt64(&s.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.c <- b:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	}
+}
+
+// send passes a block to all sinks, and returns whether any of them may
+// have held up the mix.
+func (ss *sinks) send(b block) bool {
+	ss.mutex.Lock()
+	list := make([]*Sink, 0, len(ss.set))
+	for s := range ss.set {
+		list = append(list, s)
+	}
+	ss.mutex.Unlock()
+
+	blocking := false
+	for _, s := range list {
+		if s.policy == OverflowBlock {
+			blocking = true
+		}
+		s.send(b)
+	}
+	return blocking
+}
+
+// run renders blocks for the sinks forever.
+func (m *Mix) run() {
+	const blockDuration = BlockSize * time.Second / time.Duration(SamplingFrequency)
+
+	r := newRenderer()
+	next := time.Now()
+	for {
+		out := r.next(m)
+		b := block{
+			time: atomic.LoadInt64(&m.blockTime) - BlockSize - renderDelay,
+			data: make([]byte, len(out)*2),
+		}
+		for i, v := range out {
+			binary.LittleEndian.PutUint16(b.data[2*i:2*i+2], uint16(toInt16(v)))
+		}
+
+		if m.sinks.send(b) {
+			next = time.Now()
+			continue
+		}
+
+		// keep real time when no sink sets the pace
+		next = next.Add(blockDuration)
+		if d := time.Until(next); d > 0 {
+			time.Sleep(d)
+		} else if d < -blockDuration {
+			next = time.Now()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package aujo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSinkOverflow(t *testing.T) {
+	tests := []struct {
+		policy  OverflowPolicy
+		read    bool // read reads the blocks while they are sent
+		times   []int64
+		dropped int64
+	}{
+		{OverflowBlock, true, []int64{0, 1, 2, 3, 4, 5}, 0},
+		{OverflowDropNewest, false, []int64{0, 1}, 4},
+		{OverflowDropOldest, false, []int64{4, 5}, 4},
+	}
+	for _, tt := range tests {
+		s := &Sink{policy: tt.policy, c: make(chan block, 2), done: make(chan struct{})}
+		var times []int64
+		read := make(chan struct{})
+		go func() {
+			defer close(read)
+			if !tt.read {
+				return
+			}
+			for b := range s.c {
+				times = append(times, b.time)
+			}
+		}()
+		for i := int64(0); i < 6; i++ {
+			s.send(block{time: i})
+		}
+		if tt.read {
+			close(s.c)
+			<-read
+		} else {
+			<-read
+			close(s.c)
+			for b := range s.c {
+				times = append(times, b.time)
+			}
+		}
+		if !reflect.DeepEqual(times, tt.times) {
+			t.Errorf("policy %d: blocks %v, want %v", tt.policy, times, tt.times)
+		}
+		if d := s.Dropped(); d != tt.dropped {
+			t.Errorf("policy %d: %d blocks dropped, want %d", tt.policy, d, tt.dropped)
+		}
+	}
+}
+
+func TestSinkBlockDetached(t *testing.T) {
+	s := &Sink{policy: OverflowBlock, c: make(chan block, 1), done: make(chan struct{})}
+	s.send(block{time: 0})
+	close(s.done)
+	// a detached sink must not hold up the mix
+	s.send(block{time: 1})
+	if len(s.c) != 1 {
+		t.Errorf("detached sink buffered %d blocks, want 1", len(s.c))
+	}
+}
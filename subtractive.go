@@ -0,0 +1,149 @@
+package aujo
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rwelin/aujo/dsp"
+)
+
+// Oscillator is a band limited source of a subtractive instrument.
+type Oscillator struct {
+	Waveform   string  // Waveform is "saw", "square" or "pulse"
+	Level      float64 // Level is the gain of the oscillator
+	Detune     float64 // Detune is the offset from the pitch in semitones
+	PulseWidth float64 // PulseWidth is the duty cycle of the "pulse" waveform
+}
+
+func (o *Oscillator) sample(freq float64, step float64) float64 {
+	f := freq * math.Exp2(o.Detune/12)
+	dt := f / SamplingFrequency
+	if dt >= 0.5 {
+		return 0
+	}
+	_, t := math.Modf(step * f / (2 * math.Pi))
+	if t < 0 {
+		t += 1
+	}
+
+	switch o.Waveform {
+	case "saw":
+		return o.Level * dsp.Saw(t, dt)
+	case "square":
+		return o.Level * dsp.Pulse(t, dt, 0.5)
+	case "pulse":
+		w := o.PulseWidth
+		if w <= 0 || w >= 1 {
+			w = 0.5
+		}
+		return o.Level * dsp.Pulse(t, dt, w)
+	}
+	return 0
+}
+
+// Filter is the resonant filter of a subtractive instrument. The cutoff
+// frequency is Cutoff plus EnvAmount scaled by the filter envelope, and
+// moves with the pitch by the fraction KeyTracking.
+type Filter struct {
+	Mode        string // Mode is "lowpass", "bandpass" or "highpass"
+	Cutoff      float64
+	Resonance   float64
+	KeyTracking float64
+	EnvAmount   float64
+	Envelope    ADSR
+}
+
+// Subtractive is an instrument that runs oscillators through a filter.
+type Subtractive struct {
+	Oscillators []Oscillator
+	Filter      Filter
+
+	ADSR
+}
+
+// filterState is the state of a filter and its envelope for a channel.
+type filterState struct {
+	svf       dsp.SVF
+	eventTime int64
+	envStart  float64
+	env       float64
+}
+
+func (f *Filter) process(st *filterState, c *Channel, x float64, freq float64, offset int64) float64 {
+	if st.eventTime != c.EventTime {
+		st.eventTime = c.EventTime
+		st.envStart = st.env
+	}
+
+	env, ok := f.Envelope.Level(c.Event, offset, st.envStart)
+	if !ok {
+		env = 0
+		if c.Event == EventOn {
+			env = f.Envelope.Release.Value
+		}
+	}
+	st.env = env
+
+	cutoff := f.Cutoff*math.Pow(freq/440, f.KeyTracking) + f.EnvAmount*env
+	low, band, high := st.svf.Process(x, cutoff/SamplingFrequency, f.Resonance)
+
+	switch f.Mode {
+	case "highpass":
+		return high
+	case "bandpass":
+		return band
+	}
+	return low
+}
+
+func (inst *Subtractive) Type() string {
+	return "subtractive"
+}
+
+func (f *Filter) Validate() error {
+	switch f.Mode {
+	case "", "lowpass", "bandpass", "highpass":
+	default:
+		return fmt.Errorf("unknown filter mode %q", f.Mode)
+	}
+	if f.Cutoff < 0 {
+		return fmt.Errorf("filter cutoff %g is negative", f.Cutoff)
+	}
+	if f.Resonance < 0 || f.Resonance >= 1 {
+		return fmt.Errorf("filter resonance %g is not in [0, 1)", f.Resonance)
+	}
+	return f.Envelope.Validate()
+}
+
+func (inst *Subtractive) Validate() error {
+	for i, o := range inst.Oscillators {
+		switch o.Waveform {
+		case "saw", "square", "pulse":
+		default:
+			return fmt.Errorf("oscillator %d has unknown waveform %q", i, o.Waveform)
+		}
+		if o.PulseWidth < 0 || o.PulseWidth >= 1 {
+			return fmt.Errorf("oscillator %d pulse width %g is not in [0, 1)", i, o.PulseWidth)
+		}
+	}
+	if err := inst.Filter.Validate(); err != nil {
+		return err
+	}
+	return inst.ADSR.Validate()
+}
+
+func (inst *Subtractive) Mix(c *Channel, step float64, offset int64) float64 {
+	st, _ := c.state.(*filterState)
+	if st == nil {
+		st = &filterState{eventTime: c.EventTime}
+		c.state = st
+	}
+
+	freq := pitchToFreq(c.Pitch)
+	var x float64
+	for i := range inst.Oscillators {
+		x += inst.Oscillators[i].sample(freq, step)
+	}
+
+	return inst.Filter.process(st, c, x, freq, offset)
+}
@@ -0,0 +1,200 @@
+package aujo
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type TransportState int
+
+const (
+	TransportPlaying TransportState = iota
+	TransportPaused
+	TransportStopped
+)
+
+var transportStateNames = []string{
+	TransportPlaying: "playing",
+	TransportPaused:  "paused",
+	TransportStopped: "stopped",
+}
+
+func (s TransportState) String() string {
+	if s < 0 || int(s) >= len(transportStateNames) {
+		return fmt.Sprintf("TransportState(%d)", int(s))
+	}
+	return transportStateNames[s]
+}
+
+func (s TransportState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// TransportStatus describes what the mix is playing.
+type TransportStatus struct {
+	State    TransportState
+	Sequence string // Sequence is the name of the current sequence
+	Position int64  // Position is the time in the current sequence
+	Event    int    // Event is the index of the next event of the sequence
+	Loop     bool
+	Time     int64 // Time is the number of samples played
+}
+
+// Status returns the state of the transport.
+func (m *Mix) Status() TransportStatus {
+	m.Lock()
+	defer m.Unlock()
+
+	s := TransportStatus{
+		State:    m.state,
+		Position: m.seqIndex,
+		Event:    m.event,
+		Loop:     m.loop,
+		Time:     m.index,
+	}
+	if m.seq != nil {
+		s.Sequence = m.seq.Name
+	} else if m.nextSeq != nil {
+		s.Sequence = m.nextSeq.Name
+	}
+	return s
+}
+
+// Start plays the mix after Pause or Stop.
+func (m *Mix) Start() {
+	m.Lock()
+	defer m.Unlock()
+	m.state = TransportPlaying
+}
+
+// Pause freezes the mix, which outputs silence until Start.
+func (m *Mix) Pause() {
+	m.Lock()
+	defer m.Unlock()
+	if m.state == TransportPlaying {
+		m.state = TransportPaused
+	}
+}
+
+// Stop silences all notes and rewinds the current sequence. The mix
+// outputs silence until Start.
+func (m *Mix) Stop() {
+	m.Lock()
+	defer m.Unlock()
+	m.state = TransportStopped
+	m.event = 0
+	m.seqIndex = 0
+	for i := range m.Voices {
+		m.Voices[i].channels = nil
+	}
+}
+
+// releaseAll releases the notes that are playing. The mix must be locked.
+func (m *Mix) releaseAll() {
+	for i := range m.Voices {
+		for j := range m.Voices[i].channels {
+			c := &m.Voices[i].channels[j]
+			if c.Event == EventOn {
+				c.Event = EventOff
+				c.EventTime = m.index
+				c.EventLevel = c.PrevLevel
+			}
+		}
+	}
+}
+
+// SetPosition moves to a position in the current sequence, releasing the notes
+// that are playing. Events before the position are skipped.
+func (m *Mix) SetPosition(position int64) error {
+	m.Lock()
+	defer m.Unlock()
+
+	seq := m.seq
+	if seq == nil {
+		seq = m.nextSeq
+	}
+	if seq == nil {
+		return fmt.Errorf("no sequence")
+	}
+	if position < 0 {
+		return fmt.Errorf("position %d is negative", position)
+	}
+	event := len(seq.Events)
+	for i, e := range seq.Events {
+		if e.Time >= position {
+			event = i
+			break
+		}
+	}
+	if event == len(seq.Events) {
+		return fmt.Errorf("position %d is after the end of the sequence", position)
+	}
+
+	m.releaseAll()
+	m.seq = seq
+	m.event = event
+	m.seqIndex = position
+	return nil
+}
+
+// SetLoop sets whether the current sequence repeats instead of moving on
+// to the next sequence.
+func (m *Mix) SetLoop(loop bool) {
+	m.Lock()
+	defer m.Unlock()
+	m.loop = loop
+}
+
+// SetSequence starts playing a sequence from the beginning, releasing the
+// notes that are playing. Unlike SetNextSequence it locks the mix.
+func (m *Mix) SetSequence(s *Sequence) {
+	m.Lock()
+	defer m.Unlock()
+	m.releaseAll()
+	m.seq = s
+	m.nextSeq = s
+	m.event = 0
+	m.seqIndex = 0
+	m.publishSequence()
+}
+
+var sequences = struct {
+	sync.Mutex
+	funcs map[string]func() *Sequence
+}{
+	funcs: make(map[string]func() *Sequence),
+}
+
+// RegisterSequence makes a sequence available by name. The function is
+// called each time the sequence is selected.
+func RegisterSequence(name string, f func() *Sequence) {
+	sequences.Lock()
+	defer sequences.Unlock()
+	sequences.funcs[name] = f
+}
+
+// NewSequence returns a new instance of the named sequence.
+func NewSequence(name string) (*Sequence, error) {
+	sequences.Lock()
+	f, ok := sequences.funcs[name]
+	sequences.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown sequence %q", name)
+	}
+	s := f()
+	s.Name = name
+	return s, nil
+}
+
+// SequenceNames returns the names of the registered sequences in order.
+func SequenceNames() []string {
+	sequences.Lock()
+	defer sequences.Unlock()
+	var names []string
+	for name := range sequences.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,247 @@
+package wav
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+const (
+	formatPCM        = 0x1
+	formatFloat      = 0x3
+	formatExtensible = 0xFFFE
+)
+
+var (
+	ErrNotWave = errors.New("wav: not a RIFF WAVE file")
+	ErrFormat  = errors.New("wav: unsupported sample format")
+)
+
+// Format describes the samples of a file.
+type Format struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	Float         bool
+}
+
+// Loop is a sustain loop of a file, in frames with End exclusive.
+type Loop struct {
+	Start int64
+	End   int64
+}
+
+// File is a decoded WAVE file. Samples holds one slice per channel with
+// values in [-1, 1].
+type File struct {
+	Format
+	Samples [][]float64
+	Loops   []Loop
+}
+
+// Frames returns the number of samples per channel.
+func (f *File) Frames() int {
+	if len(f.Samples) == 0 {
+		return 0
+	}
+	return len(f.Samples[0])
+}
+
+// Mono returns the average of the channels.
+func (f *File) Mono() []float64 {
+	if len(f.Samples) == 1 {
+		return f.Samples[0]
+	}
+	mono := make([]float64, f.Frames())
+	for _, ch := range f.Samples {
+		for i, v := range ch {
+			mono[i] += v / float64(len(f.Samples))
+		}
+	}
+	return mono
+}
+
+// ReadFile decodes the named file.
+func ReadFile(name string) (*File, error) {
+	r, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f, err := Decode(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return f, nil
+}
+
+// Decode reads a file with 8, 16, 24 or 32 bit integer samples or 32 or
+// 64 bit float samples.
+func Decode(r io.Reader) (*File, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, err
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, ErrNotWave
+	}
+
+	var f File
+	var haveFormat bool
+	var data []byte
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(r, hdr[:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		id := string(hdr[0:4])
+		size := int64(binary.LittleEndian.Uint32(hdr[4:8]))
+
+		if id == "data" && size == 0xFFFFFFFF {
+			// streamed files do not know their length
+			d, err := ioutil.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+			data = d
+			break
+		}
+
+		// the chunk grows as it is read, since its size may be wrong
+		chunk, err := ioutil.ReadAll(io.LimitReader(r, size+size%2))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(chunk)) < size && id != "data" {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if int64(len(chunk)) > size {
+			chunk = chunk[:size]
+		}
+
+		switch id {
+		case "fmt ":
+			if err := f.Format.decode(chunk); err != nil {
+				return nil, err
+			}
+			haveFormat = true
+		case "data":
+			data = chunk
+		case "smpl":
+			f.Loops = decodeLoops(chunk)
+		}
+	}
+
+	if !haveFormat {
+		return nil, errors.New("wav: missing fmt chunk")
+	}
+	if data == nil {
+		return nil, errors.New("wav: missing data chunk")
+	}
+
+	samples, err := f.Format.decodeSamples(data)
+	if err != nil {
+		return nil, err
+	}
+	f.Samples = samples
+	return &f, nil
+}
+
+func (format *Format) decode(chunk []byte) error {
+	if len(chunk) < 16 {
+		return errors.New("wav: short fmt chunk")
+	}
+	tag := binary.LittleEndian.Uint16(chunk[0:2])
+	format.Channels = int(binary.LittleEndian.Uint16(chunk[2:4]))
+	format.SampleRate = int(binary.LittleEndian.Uint32(chunk[4:8]))
+	format.BitsPerSample = int(binary.LittleEndian.Uint16(chunk[14:16]))
+
+	if tag == formatExtensible {
+		if len(chunk) < 26 {
+			return errors.New("wav: short extensible fmt chunk")
+		}
+		tag = binary.LittleEndian.Uint16(chunk[24:26])
+	}
+
+	switch tag {
+	case formatPCM:
+		switch format.BitsPerSample {
+		case 8, 16, 24, 32:
+		default:
+			return ErrFormat
+		}
+	case formatFloat:
+		format.Float = true
+		switch format.BitsPerSample {
+		case 32, 64:
+		default:
+			return ErrFormat
+		}
+	default:
+		return ErrFormat
+	}
+
+	if format.Channels < 1 || format.SampleRate < 1 {
+		return ErrFormat
+	}
+	return nil
+}
+
+func (format *Format) decodeSamples(data []byte) ([][]float64, error) {
+	width := format.BitsPerSample / 8
+	frame := width * format.Channels
+	frames := len(data) / frame
+
+	samples := make([][]float64, format.Channels)
+	for c := range samples {
+		samples[c] = make([]float64, frames)
+	}
+
+	for i := 0; i < frames; i++ {
+		for c := range samples {
+			b := data[i*frame+c*width:]
+			var v float64
+			switch {
+			case format.Float && width == 4:
+				v = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+			case format.Float && width == 8:
+				v = math.Float64frombits(binary.LittleEndian.Uint64(b))
+			case width == 1:
+				v = (float64(b[0]) - 128) / 128
+			case width == 2:
+				v = float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+			case width == 3:
+				u := int32(b[0]) | int32(b[1])<<8 | int32(b[2])<<16
+				v = float64(u<<8>>8) / (1 << 23)
+			case width == 4:
+				v = float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+			}
+			samples[c][i] = v
+		}
+	}
+	return samples, nil
+}
+
+func decodeLoops(chunk []byte) []Loop {
+	if len(chunk) < 36 {
+		return nil
+	}
+	n := int(binary.LittleEndian.Uint32(chunk[28:32]))
+	var loops []Loop
+	for i := 0; i < n && 36+24*(i+1) <= len(chunk); i++ {
+		l := chunk[36+24*i:]
+		loops = append(loops, Loop{
+			Start: int64(binary.LittleEndian.Uint32(l[8:12])),
+			End:   int64(binary.LittleEndian.Uint32(l[12:16])) + 1,
+		})
+	}
+	return loops
+}
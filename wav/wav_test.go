@@ -0,0 +1,130 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+)
+
+// encode returns frames of a sine in the format, interleaved by channel.
+func encode(format Format, frames int) []byte {
+	var b bytes.Buffer
+	for i := 0; i < frames; i++ {
+		v := 0.5 * math.Sin(float64(i)/10)
+		for c := 0; c < format.Channels; c++ {
+			switch {
+			case format.Float && format.BitsPerSample == 32:
+				binary.Write(&b, binary.LittleEndian, float32(v))
+			case format.Float:
+				binary.Write(&b, binary.LittleEndian, v)
+			case format.BitsPerSample == 8:
+				b.WriteByte(byte(128 + int(v*127)))
+			default:
+				n := int32(v * float64(int64(1)<<(format.BitsPerSample-1)-1))
+				var s [4]byte
+				binary.LittleEndian.PutUint32(s[:], uint32(n))
+				b.Write(s[:format.BitsPerSample/8])
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		format Format
+		frames int
+	}{
+		{Format{SampleRate: 44100, Channels: 1, BitsPerSample: 16}, 1000},
+		{Format{SampleRate: 48000, Channels: 2, BitsPerSample: 24}, 333},
+		{Format{SampleRate: 8000, Channels: 1, BitsPerSample: 8}, 101},
+		{Format{SampleRate: 44100, Channels: 2, BitsPerSample: 32, Float: true}, 10},
+		{Format{SampleRate: 44100, Channels: 1, BitsPerSample: 64, Float: true}, 0},
+	}
+	for _, tt := range tests {
+		f, err := ioutil.TempFile("", "wav")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+
+		w, err := NewWriter(f, tt.format)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.format, err)
+		}
+		data := encode(tt.format, tt.frames)
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if n := w.Frames(); n != int64(tt.frames) {
+			t.Errorf("%+v: %d frames written, want %d", tt.format, n, tt.frames)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := headerSize + len(data) + len(data)%2; len(b) != want {
+			t.Errorf("%+v: file has %d bytes, want %d", tt.format, len(b), want)
+		}
+		if n := binary.LittleEndian.Uint32(b[4:8]); int(n) != len(b)-8 {
+			t.Errorf("%+v: RIFF size %d, want %d", tt.format, n, len(b)-8)
+		}
+		if n := binary.LittleEndian.Uint32(b[40:44]); int(n) != len(data) {
+			t.Errorf("%+v: data size %d, want %d", tt.format, n, len(data))
+		}
+
+		d, err := Decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.format, err)
+		}
+		if d.Format != tt.format || d.Frames() != tt.frames || len(d.Samples) != tt.format.Channels {
+			t.Errorf("%+v: decoded %+v with %d frames", tt.format, d.Format, d.Frames())
+			continue
+		}
+		for i, v := range d.Samples[len(d.Samples)-1] {
+			if want := 0.5 * math.Sin(float64(i)/10); math.Abs(v-want) > 0.02 {
+				t.Errorf("%+v: sample %d is %g, want %g", tt.format, i, v, want)
+				break
+			}
+		}
+	}
+}
+
+func TestWriterFormats(t *testing.T) {
+	for _, format := range []Format{
+		{SampleRate: 44100, Channels: 1, BitsPerSample: 12},
+		{SampleRate: 44100, Channels: 1, BitsPerSample: 16, Float: true},
+		{SampleRate: 44100, Channels: 0, BitsPerSample: 16},
+		{SampleRate: 0, Channels: 1, BitsPerSample: 16},
+	} {
+		f, err := ioutil.TempFile("", "wav")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewWriter(f, format); err != ErrFormat {
+			t.Errorf("%+v: %v, want %v", format, err, ErrFormat)
+		}
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
+
+func TestDecodeShortChunk(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString("RIFF\x00\x00\x00\x00WAVE")
+	b.WriteString("fmt ")
+	binary.Write(&b, binary.LittleEndian, uint32(0xFFFFFFF0))
+	b.WriteString("short")
+	if _, err := Decode(&b); err != io.ErrUnexpectedEOF {
+		t.Errorf("a short fmt chunk gives %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
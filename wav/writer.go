@@ -0,0 +1,97 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const headerSize = 44
+
+// Writer writes a WAVE file. The sizes in the header are written by Close,
+// so the file must be seekable.
+type Writer struct {
+	w      io.WriteSeeker
+	format Format
+	n      int64 // n is the number of bytes of samples written
+}
+
+// NewWriter writes the header of a file with the format to w. Samples
+// are written as they are encoded in the file, interleaved by channel.
+func NewWriter(w io.WriteSeeker, format Format) (*Writer, error) {
+	tag := uint16(formatPCM)
+	switch {
+	case format.Float && (format.BitsPerSample == 32 || format.BitsPerSample == 64):
+		tag = formatFloat
+	case !format.Float && format.BitsPerSample%8 == 0 &&
+		format.BitsPerSample >= 8 && format.BitsPerSample <= 32:
+	default:
+		return nil, ErrFormat
+	}
+	if format.Channels < 1 || format.SampleRate < 1 {
+		return nil, ErrFormat
+	}
+
+	align := format.Channels * format.BitsPerSample / 8
+	var hdr [headerSize]byte
+	copy(hdr[0:4], "RIFF")
+	copy(hdr[8:12], "WAVE")
+	copy(hdr[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(hdr[16:20], 16)
+	binary.LittleEndian.PutUint16(hdr[20:22], tag)
+	binary.LittleEndian.PutUint16(hdr[22:24], uint16(format.Channels))
+	binary.LittleEndian.PutUint32(hdr[24:28], uint32(format.SampleRate))
+	binary.LittleEndian.PutUint32(hdr[28:32], uint32(format.SampleRate*align))
+	binary.LittleEndian.PutUint16(hdr[32:34], uint16(align))
+	binary.LittleEndian.PutUint16(hdr[34:36], uint16(format.BitsPerSample))
+	copy(hdr[36:40], "data")
+	if _, err := w.Write(hdr[:]); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, format: format}, nil
+}
+
+// Write writes encoded samples.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.n+int64(len(p)) > 0xFFFFFFFF-headerSize {
+		return 0, errors.New("wav: file too large")
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Frames returns the number of samples per channel written so far.
+func (w *Writer) Frames() int64 {
+	return w.n / int64(w.format.Channels*w.format.BitsPerSample/8)
+}
+
+// Close writes the sizes of the file to the header. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	size := w.n
+	if size%2 == 1 {
+		if _, err := w.w.Write([]byte{0}); err != nil {
+			return err
+		}
+		size++
+	}
+
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(size+headerSize-8))
+	if _, err := w.w.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(b[:]); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(b[:], uint32(w.n))
+	if _, err := w.w.Seek(40, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(b[:]); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(0, io.SeekEnd)
+	return err
+}